@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// snoozeMenuDays is how long findings selected in a report's snooze menu are
+// snoozed.
+const snoozeMenuDays = 7
+
+// findingIDRegex matches the IDs returned by Finding.ID.
+var findingIDRegex = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// filterAcknowledged removes findings that were acknowledged or are snoozed,
+// returning the remaining findings and the number of removed ones. Without a
+// state store, all findings are returned.
+func filterAcknowledged(g *GuildConfig, findings []Finding) ([]Finding, int) {
+	if store == nil {
+		return findings, 0
+	}
+	acks, err := store.Acks(g.GuildID)
+	if err != nil {
+		slog.Warn("could not load acknowledgements", "guild", g.Name, "error", err)
+		return findings, 0
+	}
+	now := time.Now()
+	var res []Finding
+	for _, f := range findings {
+		if ack, ok := acks[f.ID()]; ok && ack.Active(now) {
+			continue
+		}
+		res = append(res, f)
+	}
+	return res, len(findings) - len(res)
+}
+
+// snoozeFindings acknowledges findings by ID for the given number of days, or
+// until unsnoozed if days is 0.
+func snoozeFindings(g *GuildConfig, ids []string, days int, userID string) error {
+	now := time.Now()
+	for _, id := range ids {
+		ack := &Ack{Key: id, By: userID, Created: now}
+		if days > 0 {
+			ack.Until = now.AddDate(0, 0, days)
+		}
+		if err := store.SetAck(g.GuildID, ack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeSnooze confirms a snooze to the user.
+func describeSnooze(ids []string, days int) string {
+	quoted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		quoted = append(quoted, "`"+id+"`")
+	}
+	if days == 0 {
+		return fmt.Sprintf("Acknowledged %s, it won't be reported again.", strings.Join(quoted, ", "))
+	}
+	return fmt.Sprintf("Snoozed %s for %d days.", strings.Join(quoted, ", "), days)
+}
+
+func runSnooze(ctx context.Context, env *commandEnv) (*Result, error) {
+	id := env.Args["finding"]
+	if !findingIDRegex.MatchString(id) {
+		return nil, fmt.Errorf("invalid finding ID %q, expected the 8 character ID shown in reports", id)
+	}
+	days, err := strconv.Atoi(env.Args["days"])
+	if err != nil || days < 0 {
+		return nil, fmt.Errorf("invalid number of days %q", env.Args["days"])
+	}
+	if err := snoozeFindings(env.Guild, []string{id}, days, env.UserID); err != nil {
+		return nil, err
+	}
+	return &Result{Text: describeSnooze([]string{id}, days)}, nil
+}
+
+func runUnsnooze(ctx context.Context, env *commandEnv) (*Result, error) {
+	id := env.Args["finding"]
+	if !findingIDRegex.MatchString(id) {
+		return nil, fmt.Errorf("invalid finding ID %q, expected the 8 character ID shown in reports", id)
+	}
+	if err := store.DeleteAck(env.Guild.GuildID, id); err != nil {
+		return nil, err
+	}
+	return &Result{Text: fmt.Sprintf("`%s` will be reported again.", id)}, nil
+}
+
+// maxSelectOptions is Discord's limit of options in a select menu.
+const maxSelectOptions = 25
+
+// snoozeComponents returns select menus for snoozing or acknowledging the
+// findings of a report. Only the first maxSelectOptions findings are listed.
+func snoozeComponents(findings []Finding) []discordgo.MessageComponent {
+	if len(findings) == 0 {
+		return nil
+	}
+	var options []discordgo.SelectMenuOption
+	for _, f := range findings {
+		if len(options) == maxSelectOptions {
+			break
+		}
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncate(fmt.Sprintf("%s: %s", f.Name, f.Kind), 100),
+			Value:       f.ID(),
+			Description: truncate(f.Details, 100),
+		})
+	}
+	menu := func(days int, placeholder string) discordgo.MessageComponent {
+		return discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				CustomID:    fmt.Sprintf("snooze:%d", days),
+				Placeholder: placeholder,
+				MaxValues:   len(options),
+				Options:     options,
+			},
+		}}
+	}
+	return []discordgo.MessageComponent{
+		menu(snoozeMenuDays, fmt.Sprintf("Snooze for %d days…", snoozeMenuDays)),
+		menu(0, "Acknowledge permanently…"),
+	}
+}
+
+// handleSnoozeComponent handles a selection in a menu from snoozeComponents.
+func handleSnoozeComponent(s *discordgo.Session, i *discordgo.InteractionCreate, g *GuildConfig) {
+	data := i.MessageComponentData()
+	days, err := strconv.Atoi(strings.TrimPrefix(data.CustomID, "snooze:"))
+	if err != nil {
+		return
+	}
+	var reply string
+	denied := checkPermission(g, "snooze", i.Member, i.ChannelID)
+	if denied != nil {
+		reply = fmt.Sprintf("permission denied: %s", denied)
+	} else if err := snoozeFindings(g, data.Values, days, i.Member.User.ID); err != nil {
+		reply = fmt.Sprintf("error: %s", err)
+	} else {
+		reply = describeSnooze(data.Values, days)
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: reply,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		slog.Error("could not respond to interaction", "guild", g.Name, "command", "snooze", "error", err)
+	}
+	if denied != nil {
+		auditDenied(s, g, "snooze", i.Member.User, i.ChannelID, denied)
+	}
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -1,24 +1,36 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// InitBot sets up and starts the discord bot.
-func InitBot(token string, listen bool) (*discordgo.Session, error) {
+// botCtx is canceled when the bot shuts down. Commands from Discord run with
+// a context derived from it.
+var botCtx = context.Background()
+
+// InitBot sets up and starts the discord bot. If listen is set, the bot
+// handles commands until ctx is canceled.
+func InitBot(ctx context.Context, token string, listen bool) (*discordgo.Session, error) {
 	// Create a new Discord session using the provided bot token.
 	dg, err := discordgo.New("Bot " + token)
 	if err != nil {
 		return nil, err
 	}
+	dg.Client.Timeout = cfg.requestTimeout()
 
 	if listen {
+		botCtx = ctx
 		// Register the messageCreate func as a callback for MessageCreate events.
 		dg.AddHandler(messageCreate)
+		dg.AddHandler(interactionCreate)
+		health.Track(dg)
 
 		// In this example, we only care about receiving message events.
 		dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent
@@ -29,9 +41,28 @@ func InitBot(token string, listen bool) (*discordgo.Session, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if listen {
+		if err := registerCommands(dg); err != nil {
+			dg.Close()
+			return nil, err
+		}
+	}
 	return dg, nil
 }
 
+// registerCommands replaces the application commands in all configured guilds
+// with the commands from the registry.
+func registerCommands(s *discordgo.Session) error {
+	for _, g := range cfg.Guilds {
+		_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, g.GuildID, slashCommands())
+		if err != nil {
+			return fmt.Errorf("could not register commands in guild %s: %w", g.Name, err)
+		}
+	}
+	return nil
+}
+
 // This function will be called (due to AddHandler above) every time a new
 // message is created on any channel that the authenticated bot has access to.
 func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -42,26 +73,172 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
-	switch m.Content {
-	case "!get-current-projects",
-		"!get-website-projects",
-		"!check-projects",
-		"!check-releases",
-		"!check-host-responses":
-		res, err := handleCommand(m.Content, s)
+	g := cfg.Guild(m.GuildID)
+	if g == nil {
+		// Direct messages or a guild we're not configured for.
+		return
+	}
+
+	// Text commands are kept for compatibility with the slash commands.
+	if fields := strings.Fields(m.Content); len(fields) > 0 && strings.HasPrefix(fields[0], "!") && isCommand(fields[0][1:]) {
+		cmd := lookupCommand(fields[0][1:])
+		reply := func(msg *discordgo.MessageSend) {
+			if err := sendMessage(s, m.ChannelID, msg); err != nil {
+				slog.Error("could not send reply", "guild", g.Name, "command", cmd.Name, "error", err)
+			}
+		}
+		if err := checkPermission(g, cmd.Name, m.Member, m.ChannelID); err != nil {
+			reply(&discordgo.MessageSend{
+				Content:         fmt.Sprintf("permission denied: %s", err),
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+			auditDenied(s, g, cmd.Name, m.Author, m.ChannelID, err)
+			return
+		}
+		words, err := splitWords(m.Content)
+		if err != nil {
+			reply(&discordgo.MessageSend{Content: fmt.Sprintf("error: %s", err)})
+			return
+		}
+		args, err := cmd.ParseArgs(words[1:])
 		if err != nil {
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("error: %s", err))
+			reply(&discordgo.MessageSend{Content: fmt.Sprintf("error: %s", err)})
 			return
 		}
-		s.ChannelMessageSend(m.ChannelID, res)
+		res, err := runCommand(botCtx, cmd, &commandEnv{Session: s, Guild: g, Args: args, UserID: m.Author.ID})
+		if err != nil {
+			reply(&discordgo.MessageSend{Content: fmt.Sprintf("error: %s", err)})
+			return
+		}
+		if len(res.Findings) > 0 {
+			reply(findingsMessage(findingsSummary(res), res.Findings))
+		} else {
+			reply(&discordgo.MessageSend{Content: res.Text})
+		}
+		return
+	}
 
+	switch m.Content {
 	case "HONK":
-		if m.ChannelID == HonkChannelID && rand.Int31n(100) < HonkChance {
+		if g.HonkChannelID != "" && m.ChannelID == g.HonkChannelID && rand.Intn(100) < g.HonkChance {
 			go func() {
-				delay := rand.Int31n(HonkDelay * 60)
+				delay := rand.Intn(g.HonkDelay * 60)
 				time.Sleep(time.Duration(delay) * time.Second)
-				s.ChannelMessageSend(HonkChannelID, "HONK")
+				if _, err := s.ChannelMessageSend(g.HonkChannelID, "HONK"); err != nil {
+					slog.Warn("could not honk", "guild", g.Name, "error", err)
+				}
 			}()
 		}
 	}
 }
+
+// interactionCreate handles slash commands. The commands may take a while, so
+// the response is deferred and edited once the command finishes.
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	g := cfg.Guild(i.GuildID)
+	if g == nil || i.Member == nil {
+		return
+	}
+	if i.Type == discordgo.InteractionMessageComponent && strings.HasPrefix(i.MessageComponentData().CustomID, "snooze:") {
+		handleSnoozeComponent(s, i, g)
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	cmd := lookupCommand(i.ApplicationCommandData().Name)
+	if cmd == nil {
+		return
+	}
+
+	if denied := checkPermission(g, cmd.Name, i.Member, i.ChannelID); denied != nil {
+		// Discord only waits three seconds for the response, so the audit
+		// message comes after it.
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("permission denied: %s", denied),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		if err != nil {
+			slog.Error("could not respond to interaction", "guild", g.Name, "command", cmd.Name, "error", err)
+		}
+		auditDenied(s, g, cmd.Name, i.Member.User, i.ChannelID, denied)
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		slog.Error("could not respond to interaction", "guild", g.Name, "command", cmd.Name, "error", err)
+		return
+	}
+
+	args := cmd.OptionArgs(i.ApplicationCommandData().Options)
+	edit := &discordgo.WebhookEdit{}
+	res, err := runCommand(botCtx, cmd, &commandEnv{Session: s, Guild: g, Args: args, UserID: i.Member.User.ID})
+	if err != nil {
+		reply := fmt.Sprintf("error: %s", err)
+		edit.Content = &reply
+	} else if len(res.Findings) > 0 {
+		msg := findingsMessage(findingsSummary(res), res.Findings)
+		edit.Content = &msg.Content
+		edit.Embeds = &msg.Embeds
+		edit.Components = &msg.Components
+		edit.Files = msg.Files
+	} else {
+		edit.Content = &res.Text
+	}
+	if err := editInteractionResponse(s, i.Interaction, edit); err != nil {
+		slog.Error("could not edit interaction response", "guild", g.Name, "command", cmd.Name, "error", err)
+	}
+}
+
+// findingsSummary is the content of a reply with the result's findings as
+// embeds. Snoozed findings are counted and failed checks are listed since
+// they have no embeds.
+func findingsSummary(res *Result) string {
+	summary := fmt.Sprintf("%d findings:\n", len(res.Findings))
+	if len(res.Findings) == 1 {
+		summary = "1 finding:\n"
+	}
+	if res.Hidden > 0 {
+		summary += hiddenNote(res.Hidden) + "\n"
+	}
+	return summary + renderFailuresMarkdown(res.Failures)
+}
+
+// editInteractionResponse replaces the deferred response. Content that is
+// too long for one message is split into follow-up messages or attached as a
+// file like in sendMessage.
+func editInteractionResponse(s *discordgo.Session, i *discordgo.Interaction, edit *discordgo.WebhookEdit) error {
+	var parts []string
+	if edit.Content != nil {
+		parts = splitMessage(*edit.Content, messageLimit)
+	}
+	if len(parts) > maxMessageParts {
+		first, _, _ := strings.Cut(*edit.Content, "\n")
+		content := truncate(first, messageLimit-30) + "\n(full text in the attachment)"
+		edit.Files = append(edit.Files, &discordgo.File{
+			Name:        "message.md",
+			ContentType: "text/markdown; charset=utf-8",
+			Reader:      strings.NewReader(*edit.Content),
+		})
+		edit.Content = &content
+		parts = nil
+	} else if len(parts) > 0 {
+		edit.Content = &parts[0]
+	}
+	if _, err := s.InteractionResponseEdit(i, edit); err != nil {
+		return err
+	}
+	for n := 1; n < len(parts); n++ {
+		_, err := s.FollowupMessageCreate(i, true, &discordgo.WebhookParams{Content: parts[n], AllowedMentions: edit.AllowedMentions})
+		if err != nil {
+			return fmt.Errorf("could not send follow-up message: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/youtube/v3"
+)
+
+// Source is a data source that checks read. Sources are fetched at most once
+// per run and shared between checks.
+type Source int
+
+const (
+	SourceDiscordProjects Source = 1 << iota // projects in #current-projects
+	SourceDiscordPins                        // pinned messages in project channels
+	SourceWebsiteProjects                    // projects on the website
+	SourceWebsiteLinks                       // links on the website project pages
+	SourceWebsiteReleases                    // videos on the website releases page
+	SourcePlaylist                           // videos in the YouTube playlist
+)
+
+// Check is a consistency check between data sources.
+type Check interface {
+	// Name identifies the check in the config and in findings.
+	Name() string
+	// Sources returns the data sources the check reads.
+	Sources() Source
+	// Run compares the data and returns its findings. If only some parts of
+	// the check fail, e.g. a single project, Run returns the findings of the
+	// other parts along with a partErrors error.
+	Run(ctx context.Context, d *checkData) ([]Finding, error)
+}
+
+// checkRegistry contains all checks in the order they run.
+var checkRegistry []Check
+
+// registerCheck adds a check to the registry.
+func registerCheck(c Check) {
+	if lookupCheck(c.Name()) != nil {
+		panic("duplicate check " + c.Name())
+	}
+	checkRegistry = append(checkRegistry, c)
+}
+
+// lookupCheck returns the check with the given name or nil.
+func lookupCheck(name string) Check {
+	for _, c := range checkRegistry {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// checkNames returns the names of all registered checks.
+func checkNames() []string {
+	var names []string
+	for _, c := range checkRegistry {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// enabledChecks returns the checks from names that are enabled in the guild.
+// All registered checks are considered if names is empty.
+func enabledChecks(g *GuildConfig, names ...string) []Check {
+	if len(names) == 0 {
+		names = checkNames()
+	}
+	var res []Check
+	for _, name := range names {
+		if c := lookupCheck(name); c != nil && !g.checkConfig(name).Disabled {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// lazy caches the result of a fetch, including errors, so that a source that
+// fails for one check isn't fetched again for the others.
+// It is safe for concurrent use.
+type lazy[T any] struct {
+	mu   sync.Mutex
+	done bool
+	val  T
+	err  error
+}
+
+func (l *lazy[T]) get(fetch func() (T, error)) (T, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.done {
+		l.val, l.err = fetch()
+		l.done = true
+	}
+	return l.val, l.err
+}
+
+// checkData fetches and caches the data for a check run.
+type checkData struct {
+	Session discordSession
+	Guild   *GuildConfig
+	Only    string // restrict to the project with this ID if not empty
+
+	discordProjects lazy[[]*Project]
+	websiteProjects lazy[[]*Project]
+	websiteLinks    lazy[struct{}]
+	pinsMu          sync.Mutex
+	pins            map[string]*lazy[[]string] // by project ID
+	releases        lazy[[]string]
+	videos          lazy[[]youtube.PlaylistItem]
+}
+
+func newCheckData(s discordSession, g *GuildConfig) *checkData {
+	return &checkData{Session: s, Guild: g, pins: make(map[string]*lazy[[]string])}
+}
+
+// Available returns an error if a source can't be used for the guild.
+func (d *checkData) Available(sources Source) error {
+	if sources&(SourceDiscordProjects|SourceDiscordPins) != 0 && d.Session == nil {
+		return fmt.Errorf("no Discord session")
+	}
+	if sources&SourcePlaylist != 0 {
+		if yt == nil {
+			return fmt.Errorf("no YouTube credentials supplied")
+		}
+		if d.Guild.PlaylistID == "" {
+			return fmt.Errorf("no playlist configured for this guild")
+		}
+	}
+	return nil
+}
+
+// DiscordProjects returns the projects from #current-projects.
+func (d *checkData) DiscordProjects(ctx context.Context) ([]*Project, error) {
+	return d.discordProjects.get(func() ([]*Project, error) {
+		projects, err := getCurrentProjects(ctx, d.Session, d.Guild, false)
+		if err != nil {
+			return nil, fmt.Errorf("could not get #current-projects: %w", err)
+		}
+		return d.filter(projects), nil
+	})
+}
+
+// WebsiteProjects returns the projects from the website.
+func (d *checkData) WebsiteProjects(ctx context.Context) ([]*Project, error) {
+	return d.websiteProjects.get(func() ([]*Project, error) {
+		projects, err := getWebsiteProjects(ctx, d.Guild)
+		if err != nil {
+			return nil, fmt.Errorf("could not get website projects: %w", err)
+		}
+		return d.filter(projects), nil
+	})
+}
+
+// WebsiteProjectsWithLinks returns the projects from the website with their
+// URLs populated from the project pages. If some project pages could not be
+// fetched, the projects are returned along with a partErrors error and the
+// failed projects have no URLs.
+func (d *checkData) WebsiteProjectsWithLinks(ctx context.Context) ([]*Project, error) {
+	projects, err := d.WebsiteProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = d.websiteLinks.get(func() (struct{}, error) {
+		return struct{}{}, fetchWebsiteProjectLinks(ctx, d.Guild, projects)
+	})
+	return projects, err
+}
+
+// PinnedLinks returns the sorted URLs pinned in the project's channel.
+func (d *checkData) PinnedLinks(ctx context.Context, p *Project) ([]string, error) {
+	d.pinsMu.Lock()
+	l, ok := d.pins[p.ID]
+	if !ok {
+		l = &lazy[[]string]{}
+		d.pins[p.ID] = l
+	}
+	d.pinsMu.Unlock()
+	return l.get(func() ([]string, error) {
+		if err := fetchDiscordProjectLinks(ctx, d.Session, p); err != nil {
+			return nil, fmt.Errorf("could not fetch links for %s: %w", p.ID, err)
+		}
+		sort.Strings(p.URLs)
+		return p.URLs, nil
+	})
+}
+
+// WebsiteReleases returns the video IDs on the website releases page.
+func (d *checkData) WebsiteReleases(ctx context.Context) ([]string, error) {
+	return d.releases.get(func() ([]string, error) {
+		ids, err := getWebsiteReleases(ctx, d.Guild)
+		if err != nil {
+			return nil, fmt.Errorf("could not get website releases: %w", err)
+		}
+		return ids, nil
+	})
+}
+
+// PlaylistVideos returns the videos in the guild's YouTube playlist.
+func (d *checkData) PlaylistVideos(ctx context.Context) ([]youtube.PlaylistItem, error) {
+	return d.videos.get(func() ([]youtube.PlaylistItem, error) {
+		videos, err := getYoutubeVideos(ctx, yt, d.Guild)
+		if err != nil {
+			return nil, fmt.Errorf("could not get YouTube playlist: %w", err)
+		}
+		return videos, nil
+	})
+}
+
+// prefetch fetches the sources concurrently. Independent sources are
+// fetched at the same time, the website links and pins once the projects are
+// known. Errors are cached and returned when the checks access the data.
+func (d *checkData) prefetch(ctx context.Context, sources Source) {
+	var fetches []func()
+	if sources&SourceDiscordProjects != 0 {
+		fetches = append(fetches, func() { d.DiscordProjects(ctx) })
+	}
+	if sources&SourceWebsiteProjects != 0 {
+		fetches = append(fetches, func() { d.WebsiteProjects(ctx) })
+	}
+	if sources&SourceWebsiteReleases != 0 {
+		fetches = append(fetches, func() { d.WebsiteReleases(ctx) })
+	}
+	if sources&SourcePlaylist != 0 {
+		fetches = append(fetches, func() { d.PlaylistVideos(ctx) })
+	}
+	parallel(len(fetches), len(fetches), func(i int) { fetches[i]() })
+
+	if sources&SourceWebsiteLinks == 0 {
+		return
+	}
+	website, _ := d.WebsiteProjectsWithLinks(ctx)
+	if sources&SourceDiscordPins == 0 {
+		return
+	}
+	projects, _ := d.DiscordProjects(ctx)
+	projectsMap := projectsByID(projects)
+	var pinned []*Project
+	for _, w := range website {
+		if p, ok := projectsMap[w.ID]; ok && len(w.URLs) > 0 {
+			pinned = append(pinned, p)
+		}
+	}
+	parallel(cfg.FetchWorkers, len(pinned), func(i int) { d.PinnedLinks(ctx, pinned[i]) })
+}
+
+func (d *checkData) filter(projects []*Project) []*Project {
+	res := []*Project{}
+	for _, p := range projects {
+		if d.Only == "" || p.ID == d.Only {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// partErrors collects the errors of the parts of a check that failed
+// independently of each other, e.g. fetching the pins of a single project.
+type partErrors []error
+
+// add appends err unless it is nil. Nested partErrors are flattened.
+func (e *partErrors) add(err error) {
+	if pe, ok := err.(partErrors); ok {
+		*e = append(*e, pe...)
+	} else if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// err returns the collected errors or nil if there are none.
+func (e partErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e partErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// CheckFailure is a check or a part of a check that could not run.
+type CheckFailure struct {
+	Check string `json:"check"`
+	Error string `json:"error"`
+}
+
+// runChecks fetches the data sources of the checks concurrently and then runs
+// the checks independently of each other. It returns the combined findings of
+// all checks and the failures of checks that could not run completely.
+// Findings from the parts of a check that succeeded are returned even if
+// other parts failed.
+func runChecks(ctx context.Context, d *checkData, checks []Check) ([]Finding, []CheckFailure) {
+	var sources Source
+	for _, c := range checks {
+		if d.Available(c.Sources()) == nil {
+			sources |= c.Sources()
+		}
+	}
+	d.prefetch(ctx, sources)
+
+	var findings []Finding
+	var failures []CheckFailure
+	for _, c := range checks {
+		var errs partErrors
+		if err := d.Available(c.Sources()); err != nil {
+			errs.add(err)
+		} else {
+			start := time.Now()
+			res, err := c.Run(ctx, d)
+			metricCheckDuration.WithLabelValues(d.Guild.Name, c.Name()).Observe(time.Since(start).Seconds())
+			errs.add(err)
+			for i := range res {
+				res[i].Check = c.Name()
+			}
+			findings = append(findings, res...)
+		}
+		for _, err := range errs {
+			failures = append(failures, CheckFailure{Check: c.Name(), Error: err.Error()})
+		}
+		metricCheckFailures.WithLabelValues(d.Guild.Name, c.Name()).Add(float64(len(errs)))
+	}
+	sortFindings(findings)
+	return findings, failures
+}
+
+// failedChecks returns the names of the checks that failed.
+func failedChecks(failures []CheckFailure) map[string]bool {
+	res := make(map[string]bool)
+	for _, f := range failures {
+		res[f.Check] = true
+	}
+	return res
+}
+
+// failuresError combines check failures into an error, or returns nil if
+// there are none.
+func failuresError(failures []CheckFailure) error {
+	var errs partErrors
+	for _, f := range failures {
+		errs.add(fmt.Errorf("%s: %s", f.Check, f.Error))
+	}
+	return errs.err()
+}
+
+// renderFailuresMarkdown renders check failures as Markdown list for Discord.
+func renderFailuresMarkdown(failures []CheckFailure) string {
+	if len(failures) == 0 {
+		return ""
+	}
+	var msg strings.Builder
+	msg.WriteString("Failed:\n")
+	for _, f := range failures {
+		fmt.Fprintf(&msg, "- %s: %s\n", f.Check, f.Error)
+	}
+	return msg.String()
+}
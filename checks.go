@@ -3,8 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"math"
-	"net/http"
 	"net/url"
 	"regexp"
 	"sort"
@@ -20,12 +20,13 @@ import (
 
 // Project contains information about a UVE project.
 type Project struct {
-	ID       string // channel name / URL slug
-	Name     string
-	Channel  *discordgo.Channel
-	Deadline time.Time
-	Status   string   // e.g., "Accepting Recordings"
-	URLs     []string // URLs in the body of the project page
+	ID       string             `json:"id"` // channel name / URL slug
+	Name     string             `json:"name"`
+	Channel  *discordgo.Channel `json:"-"`
+	Deadline time.Time          `json:"deadline"`
+	Status   string             `json:"status,omitempty"` // e.g., "Accepting Recordings"
+	URLs     []string           `json:"urls,omitempty"`   // URLs in the body of the project page
+	Message  *discordgo.Message `json:"-"`                // entry in #current-projects
 }
 
 // ProjectsByDeadline implements sort.Interface for []*Person based on the Deadline field.
@@ -50,6 +51,7 @@ func parseProject(msg *discordgo.Message, channels []*discordgo.Channel) (*Proje
 	lines := strings.Split(msg.Content, "\n")
 	var p Project
 	p.Name = lines[0]
+	p.Message = msg
 	for _, line := range lines {
 		// Deadline: December 29 (Extension)
 		if strings.HasPrefix(line, "Deadline: ") {
@@ -88,79 +90,208 @@ func parseProject(msg *discordgo.Message, channels []*discordgo.Channel) (*Proje
 	return &p, nil
 }
 
-// checkCurrentProjects compares the projects in #current-projects and the website.
-func checkCurrentProjects(s *discordgo.Session, guildID string) (string, error) {
-	projects, err := getCurrentProjects(s, guildID)
-	if err != nil {
-		return "", err
+func init() {
+	registerCheck(deadlineCheck{})
+	registerCheck(passedDeadlineCheck{})
+	registerCheck(pinnedURLsCheck{})
+	registerCheck(missingProjectsCheck{})
+	registerCheck(releasesCheck{})
+}
+
+// projectFinding returns a finding about a project, referring to where it is
+// listed. Either the website project or the #current-projects entry may be
+// nil if the project is only listed in one place.
+func projectFinding(g *GuildConfig, website, project *Project, kind FindingKind, severity Severity, details string, links ...string) Finding {
+	ref := &ProjectRef{}
+	var id string
+	if website != nil {
+		id = website.ID
+		ref.WebsiteURL = g.WebsiteURL + "/projects/" + website.ID
+		ref.WebsiteDeadline = website.Deadline
+	}
+	if project != nil {
+		id = project.ID
+		ref.Deadline = project.Deadline
+		if project.Channel != nil {
+			ref.ChannelID = project.Channel.ID
+		}
+		if project.Message != nil {
+			ref.MessageURL = messageURL(g.GuildID, project.Message)
+		}
+	}
+	return Finding{
+		Subject:  id,
+		Name:     id,
+		Kind:     kind,
+		Severity: severity,
+		Details:  details,
+		Links:    links,
+		Project:  ref,
+	}
+}
+
+// messageURL returns a link to the message.
+func messageURL(guildID string, msg *discordgo.Message) string {
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, msg.ChannelID, msg.ID)
+}
+
+// deadlinePassed reports whether the project's deadline is more than two days
+// in the past.
+func deadlinePassed(p *Project) bool {
+	return time.Now().AddDate(0, 0, -2).After(p.Deadline)
+}
+
+// projectsByID returns the projects keyed by ID.
+func projectsByID(projects []*Project) map[string]*Project {
+	m := make(map[string]*Project)
+	for _, p := range projects {
+		m[p.ID] = p
 	}
-	website, err := getWebsiteProjects()
+	return m
+}
+
+// forEachListedProject calls fn for every project that is both on the website
+// and in #current-projects.
+func forEachListedProject(ctx context.Context, d *checkData, fn func(website, project *Project) error) error {
+	projects, err := d.DiscordProjects(ctx)
 	if err != nil {
-		return "", err
+		return err
 	}
-	err = fetchWebsiteProjectLinks(website)
+	website, err := d.WebsiteProjects(ctx)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	projectsMap := make(map[string]*Project)
-	websiteMap := make(map[string]*Project)
-	buildMap := func(projects []*Project, m map[string]*Project) {
-		for _, p := range projects {
-			m[p.ID] = p
+	projectsMap := projectsByID(projects)
+	for _, w := range website {
+		if p, ok := projectsMap[w.ID]; ok {
+			if err := fn(w, p); err != nil {
+				return err
+			}
 		}
 	}
-	buildMap(projects, projectsMap)
-	buildMap(website, websiteMap)
+	return nil
+}
 
-	var msg strings.Builder
-	for id, website := range websiteMap {
-		project, ok := projectsMap[id]
-		if ok {
-			if website.Deadline != project.Deadline {
-				fmt.Fprintf(&msg, "- %s: wrong deadline (website: %s, #current-projects: %s)\n", id, website.Deadline.Format("2006-01-02"), project.Deadline.Format("2006-01-02"))
-			}
-			if time.Now().AddDate(0, 0, -2).After(project.Deadline) && project.Status != "Accepting Recordings" {
-				fmt.Fprintf(&msg, "- %s: deadline %s has passed\n", id, project.Deadline.Format("2006-01-02"))
-			}
-			if len(website.URLs) > 0 {
-				err = fetchDiscordProjectLinks(s, project)
-				sort.Slice(project.URLs, func(i, j int) bool {
-					return project.URLs[i] < project.URLs[j]
-				})
-				if err != nil {
-					return "", fmt.Errorf("error fetching links for %s: %w", project.ID, err)
-				}
-				for _, u := range website.URLs {
-					// Does the URL also appear in Discord?
-					idx := sort.SearchStrings(project.URLs, u)
-					if idx == len(project.URLs) || project.URLs[idx] != u {
-						// However, Discord links are always okay (non-PD projects)
-						if !strings.HasPrefix(u, "https://discord.gg/") {
-							fmt.Fprintf(&msg, "- %s: URL does not appear in channel pins %s\n", id, u)
-						}
-					}
+// deadlineCheck compares the deadlines on the website and in
+// #current-projects.
+type deadlineCheck struct{}
+
+func (deadlineCheck) Name() string    { return "deadline" }
+func (deadlineCheck) Sources() Source { return SourceDiscordProjects | SourceWebsiteProjects }
+
+func (deadlineCheck) Run(ctx context.Context, d *checkData) ([]Finding, error) {
+	var findings []Finding
+	err := forEachListedProject(ctx, d, func(website, project *Project) error {
+		if website.Deadline != project.Deadline {
+			findings = append(findings, projectFinding(d.Guild, website, project, KindWrongDeadline, SeverityWarning, fmt.Sprintf("wrong deadline (website: %s, #current-projects: %s)", website.Deadline.Format("2006-01-02"), project.Deadline.Format("2006-01-02"))))
+		}
+		return nil
+	})
+	return findings, err
+}
+
+// passedDeadlineCheck finds projects that are still listed after their
+// deadline.
+type passedDeadlineCheck struct{}
+
+func (passedDeadlineCheck) Name() string    { return "passed-deadline" }
+func (passedDeadlineCheck) Sources() Source { return SourceDiscordProjects | SourceWebsiteProjects }
+
+func (passedDeadlineCheck) Run(ctx context.Context, d *checkData) ([]Finding, error) {
+	var findings []Finding
+	err := forEachListedProject(ctx, d, func(website, project *Project) error {
+		if deadlinePassed(project) && project.Status != "Accepting Recordings" {
+			findings = append(findings, projectFinding(d.Guild, website, project, KindDeadlinePassed, SeverityWarning, fmt.Sprintf("deadline %s has passed", project.Deadline.Format("2006-01-02"))))
+		}
+		return nil
+	})
+	return findings, err
+}
+
+// pinnedURLsCheck finds URLs on the website project page that are not pinned
+// in the project's channel.
+type pinnedURLsCheck struct{}
+
+func (pinnedURLsCheck) Name() string { return "pinned-urls" }
+func (pinnedURLsCheck) Sources() Source {
+	return SourceDiscordProjects | SourceDiscordPins | SourceWebsiteProjects | SourceWebsiteLinks
+}
+
+func (pinnedURLsCheck) Run(ctx context.Context, d *checkData) ([]Finding, error) {
+	var errs partErrors
+	projects, err := d.WebsiteProjectsWithLinks(ctx)
+	if projects == nil {
+		return nil, err
+	}
+	errs.add(err)
+	var findings []Finding
+	err = forEachListedProject(ctx, d, func(website, project *Project) error {
+		if len(website.URLs) == 0 {
+			return nil
+		}
+		pinned, err := d.PinnedLinks(ctx, project)
+		if err != nil {
+			errs.add(err)
+			return nil
+		}
+		for _, u := range website.URLs {
+			// Does the URL also appear in Discord?
+			idx := sort.SearchStrings(pinned, u)
+			if idx == len(pinned) || pinned[idx] != u {
+				// However, Discord links are always okay (non-PD projects)
+				if !strings.HasPrefix(u, "https://discord.gg/") {
+					findings = append(findings, projectFinding(d.Guild, website, project, KindURLNotPinned, SeverityInfo, fmt.Sprintf("URL does not appear in channel pins %s", u), u))
 				}
 			}
-		} else {
-			fmt.Fprintf(&msg, "- %s: on website but not in #current-projects\n", id)
+		}
+		return nil
+	})
+	errs.add(err)
+	return findings, errs.err()
+}
+
+// missingProjectsCheck finds projects that are only listed either on the
+// website or in #current-projects.
+type missingProjectsCheck struct{}
+
+func (missingProjectsCheck) Name() string    { return "missing-projects" }
+func (missingProjectsCheck) Sources() Source { return SourceDiscordProjects | SourceWebsiteProjects }
+
+func (missingProjectsCheck) Run(ctx context.Context, d *checkData) ([]Finding, error) {
+	projects, err := d.DiscordProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	website, err := d.WebsiteProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projectsMap := projectsByID(projects)
+	websiteMap := projectsByID(website)
+	var findings []Finding
+	for id, website := range websiteMap {
+		if _, ok := projectsMap[id]; !ok {
+			findings = append(findings, projectFinding(d.Guild, website, nil, KindNotInCurrentProjects, SeverityWarning, "on website but not in #current-projects"))
 		}
 	}
 	for id, project := range projectsMap {
-		if time.Now().AddDate(0, 0, -2).After(project.Deadline) {
+		if deadlinePassed(project) {
 			// deadline has passed, skip
 			continue
 		}
 		if _, ok := websiteMap[id]; !ok {
-			fmt.Fprintf(&msg, "- %s: missing on website\n", id)
+			findings = append(findings, projectFinding(d.Guild, nil, project, KindMissingOnWebsite, SeverityWarning, "missing on website"))
 		}
 	}
-	return msg.String(), nil
+	return findings, nil
 }
 
-// getCurrentProjects retrieves current projects from the Discord channel #current-projects.
-func getCurrentProjects(s *discordgo.Session, guildID string) ([]*Project, error) {
-	channels, err := s.GuildChannels(guildID)
+// getCurrentProjects retrieves current projects from the Discord channel
+// #current-projects. Entries without a channel are skipped unless all is set.
+func getCurrentProjects(ctx context.Context, s discordSession, g *GuildConfig, all bool) ([]*Project, error) {
+	channels, err := retryValue(ctx, serviceDiscord, "guild channels", func(ctx context.Context) ([]*discordgo.Channel, error) {
+		return s.GuildChannels(g.GuildID)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -174,18 +305,21 @@ func getCurrentProjects(s *discordgo.Session, guildID string) ([]*Project, error
 	if projectsChannel == nil {
 		return nil, fmt.Errorf("could not find #current-projects")
 	}
-	messages, err := s.ChannelMessages(projectsChannel.ID, 20, "", "", "")
+	messages, err := retryValue(ctx, serviceDiscord, "#current-projects", func(ctx context.Context) ([]*discordgo.Message, error) {
+		return s.ChannelMessages(projectsChannel.ID, 20, "", "", "")
+	})
+	if err != nil {
+		return nil, err
+	}
 	var projects []*Project
 	for _, msg := range messages {
 		p, err := parseProject(msg, channels)
 		if err != nil {
-			errmsg := fmt.Sprintf("could not parse project: %s", err)
-			fmt.Println(errmsg)
-			s.ChannelMessageSend(StaffBotSpamChannelID, errmsg)
+			slog.Warn("could not parse project", "guild", g.Name, "message", msg.ID, "error", err)
 			continue
 		}
 		// Chamber projects use threads which we can't retrieve for now.
-		if p.ID == "" {
+		if p.ID == "" && !all {
 			continue
 		}
 		projects = append(projects, p)
@@ -198,11 +332,13 @@ func getCurrentProjects(s *discordgo.Session, guildID string) ([]*Project, error
 var urlRegex *regexp.Regexp = regexp.MustCompile(`https?://[^\s*]+`)
 
 // fetchDiscordProjectLinks populates the project's URLs field from pinned messages in Discord.
-func fetchDiscordProjectLinks(s *discordgo.Session, p *Project) error {
+func fetchDiscordProjectLinks(ctx context.Context, s discordSession, p *Project) error {
 	if p.Channel == nil {
 		return nil
 	}
-	pinned, err := s.ChannelMessagesPinned(p.Channel.ID)
+	pinned, err := retryValue(ctx, serviceDiscord, "pins #"+p.Channel.Name, func(ctx context.Context) ([]*discordgo.Message, error) {
+		return s.ChannelMessagesPinned(p.Channel.ID)
+	})
 	if err != nil {
 		return err
 	}
@@ -218,21 +354,24 @@ func fetchDiscordProjectLinks(s *discordgo.Session, p *Project) error {
 	return nil
 }
 
-func httpGetDoc(url string) (*goquery.Document, error) {
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status code %d (getting %s)", res.StatusCode, url)
-	}
-	return goquery.NewDocumentFromReader(res.Body)
+// httpGetDoc fetches and parses an HTML page, retrying transient errors.
+func httpGetDoc(ctx context.Context, url string) (*goquery.Document, error) {
+	var doc *goquery.Document
+	err := retry(ctx, serviceWebsite, "GET "+url, func(ctx context.Context) error {
+		res, err := httpGet(ctx, url)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		doc, err = goquery.NewDocumentFromReader(res.Body)
+		return err
+	})
+	return doc, err
 }
 
 // getWebsiteProjects retrieves current projects from the UVE website.
-func getWebsiteProjects() ([]*Project, error) {
-	doc, err := httpGetDoc(WebsiteURL)
+func getWebsiteProjects(ctx context.Context, g *GuildConfig) ([]*Project, error) {
+	doc, err := httpGetDoc(ctx, g.WebsiteURL)
 	if err != nil {
 		return nil, err
 	}
@@ -269,12 +408,16 @@ func getWebsiteProjects() ([]*Project, error) {
 	return projects, nil
 }
 
-// fetchWebsiteProjectLinks populates the project's URLs field.
-func fetchWebsiteProjectLinks(projects []*Project) error {
-	for _, p := range projects {
-		doc, err := httpGetDoc(WebsiteURL + "/projects/" + p.ID)
+// fetchWebsiteProjectLinks populates the project's URLs field. Projects whose
+// page can't be fetched are skipped and reported in the returned partErrors.
+func fetchWebsiteProjectLinks(ctx context.Context, g *GuildConfig, projects []*Project) error {
+	errs := make([]error, len(projects))
+	parallel(cfg.FetchWorkers, len(projects), func(i int) {
+		p := projects[i]
+		doc, err := httpGetDoc(ctx, g.WebsiteURL+"/projects/"+p.ID)
 		if err != nil {
-			return err
+			errs[i] = fmt.Errorf("could not fetch project page of %s: %w", p.ID, err)
+			return
 		}
 		// Find all links in the main text
 		doc.Find(`div[role=main] section:nth-child(2) a`).Each(func(i int, s *goquery.Selection) {
@@ -282,44 +425,43 @@ func fetchWebsiteProjectLinks(projects []*Project) error {
 				if strings.HasPrefix(href, "https://www.google.com/url?q=") {
 					gurl, err := url.Parse(href)
 					if err != nil {
-						fmt.Println("error while decoding google url: ", err)
+						slog.Warn("could not decode Google redirect URL", "guild", g.Name, "project", p.ID, "url", href, "error", err)
+						return
 					}
 					href = gurl.Query().Get("q")
 				}
 				p.URLs = append(p.URLs, href)
 			}
 		})
+	})
+	var res partErrors
+	for _, err := range errs {
+		res.add(err)
 	}
-	return nil
+	return res.err()
 }
 
-// getYoutubeVideos retrieves UVE's youtube playlist.
-func getYoutubeVideos(yt *youtube.Service) ([]youtube.PlaylistItem, error) {
+// getYoutubeVideos retrieves the guild's youtube playlist.
+func getYoutubeVideos(ctx context.Context, yt *youtube.Service, g *GuildConfig) ([]youtube.PlaylistItem, error) {
 	var videos []youtube.PlaylistItem
-	call := yt.PlaylistItems.List([]string{"snippet", "contentDetails"}).PlaylistId(UVEPlaylistID).MaxResults(50)
-	err := call.Pages(context.TODO(), func(res *youtube.PlaylistItemListResponse) error {
-		for _, item := range res.Items {
-			videos = append(videos, *item)
-		}
-		return nil
+	err := retry(ctx, serviceYouTube, "playlist "+g.PlaylistID, func(ctx context.Context) error {
+		videos = nil
+		call := yt.PlaylistItems.List([]string{"snippet", "contentDetails"}).PlaylistId(g.PlaylistID).MaxResults(50)
+		return call.Pages(ctx, func(res *youtube.PlaylistItemListResponse) error {
+			for _, item := range res.Items {
+				videos = append(videos, *item)
+			}
+			return nil
+		})
 	})
 	return videos, err
 }
 
 var youtubeIDRegex = regexp.MustCompile(`(?i)(?:youtube\.com\/(?:[^\/]+\/.+\/|(?:v|e(?:mbed)?)\/|.*[?&]v=)|youtu\.be\/)([^"&?\/\s]{11})`)
 
-// getWebsiteProjects retrieves current projects from the UVE website.
-func getWebsiteReleases() ([]string, error) {
-	res, err := http.Get(WebsiteReleasesURL)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("unexpected status code %d (getting %s)", res.StatusCode, WebsiteURL)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+// getWebsiteReleases retrieves the released videos from the UVE website.
+func getWebsiteReleases(ctx context.Context, g *GuildConfig) ([]string, error) {
+	doc, err := httpGetDoc(ctx, g.WebsiteReleasesURL)
 	if err != nil {
 		return nil, err
 	}
@@ -344,17 +486,22 @@ func getWebsiteReleases() ([]string, error) {
 	return videoIDs, nil
 }
 
-// checkReleases compares the website release page with the YouTube playlist.
-func checkReleases(yt *youtube.Service) (string, error) {
-	var msg strings.Builder
+// releasesCheck compares the website release page with the YouTube playlist.
+type releasesCheck struct{}
+
+func (releasesCheck) Name() string    { return "releases" }
+func (releasesCheck) Sources() Source { return SourceWebsiteReleases | SourcePlaylist }
 
-	websiteIDs, err := getWebsiteReleases()
+func (releasesCheck) Run(ctx context.Context, d *checkData) ([]Finding, error) {
+	var findings []Finding
+
+	websiteIDs, err := d.WebsiteReleases(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	videos, err := getYoutubeVideos(yt)
+	videos, err := d.PlaylistVideos(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	videoMap := make(map[string]youtube.PlaylistItem)
@@ -371,17 +518,33 @@ func checkReleases(yt *youtube.Service) (string, error) {
 			continue
 		}
 		if _, ok := websiteMap[v.ContentDetails.VideoId]; !ok {
-			fmt.Fprintf(&msg, "- %s: missing on website (https://youtu.be/%s)\n", v.Snippet.Title, v.ContentDetails.VideoId)
+			link := "https://youtu.be/" + v.ContentDetails.VideoId
+			findings = append(findings, Finding{
+				Subject:  v.ContentDetails.VideoId,
+				Name:     v.Snippet.Title,
+				Kind:     KindReleaseMissingOnWebsite,
+				Severity: SeverityWarning,
+				Details:  fmt.Sprintf("missing on website (%s)", link),
+				Links:    []string{link},
+			})
 		}
 	}
 
 	for _, v := range websiteIDs {
 		if _, ok := videoMap[v]; !ok {
-			fmt.Fprintf(&msg, "- https://youtu.be/%s missing in playlist\n", v)
+			link := "https://youtu.be/" + v
+			findings = append(findings, Finding{
+				Subject:  v,
+				Name:     link,
+				Kind:     KindReleaseMissingInPlaylist,
+				Severity: SeverityWarning,
+				Details:  "missing in playlist",
+				Links:    []string{link},
+			})
 		}
 	}
 
-	return msg.String(), nil
+	return findings, nil
 }
 
 type hostResponse struct {
@@ -395,9 +558,13 @@ type hostResponse struct {
 	Response [][]string
 }
 
-// checkHostResponses queries Google Sheets for new host responses.
-func checkHostResponses(sheetsService *sheets.Service) ([]hostResponse, error) {
-	stateRes, err := sheetsService.Spreadsheets.Values.Get(HostResponsesSheetID, HostResponsesBotSheet+"!B3:B3").Do()
+// checkHostResponses queries Google Sheets for new host responses. Unless
+// dryRun is set, the last row id in the sheet is advanced past the returned
+// responses.
+func checkHostResponses(ctx context.Context, sheetsService *sheets.Service, g *GuildConfig, dryRun bool) ([]hostResponse, error) {
+	stateRes, err := retryValue(ctx, serviceSheets, "bot state", func(ctx context.Context) (*sheets.ValueRange, error) {
+		return sheetsService.Spreadsheets.Values.Get(g.HostResponsesSheetID, g.HostResponsesBotSheet+"!B3:B3").Context(ctx).Do()
+	})
 	if err != nil {
 		return nil, fmt.Errorf("could not query host responses sheet for bot state: %w", err)
 	}
@@ -405,22 +572,31 @@ func checkHostResponses(sheetsService *sheets.Service) ([]hostResponse, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid last row id: %w", err)
 	}
-	res, err := sheetsService.Spreadsheets.Values.Get(HostResponsesSheetID, fmt.Sprintf("%s!A%d:M", HostResponsesSheet, id)).ValueRenderOption("UNFORMATTED_VALUE").Do()
+	res, err := retryValue(ctx, serviceSheets, "host responses", func(ctx context.Context) (*sheets.ValueRange, error) {
+		return sheetsService.Spreadsheets.Values.Get(g.HostResponsesSheetID, fmt.Sprintf("%s!A%d:M", g.HostResponsesSheet, id)).ValueRenderOption("UNFORMATTED_VALUE").Context(ctx).Do()
+	})
 	if err != nil {
 		return nil, fmt.Errorf("could not query host responses sheet: %w", err)
 	}
 	var titles []string
 	if len(res.Values) > 0 {
-		rb := &sheets.ValueRange{
-			Values: [][]interface{}{{id + len(res.Values)}},
-		}
-		_, err = sheetsService.Spreadsheets.Values.Update(HostResponsesSheetID, HostResponsesBotSheet+"!B3:B3", rb).ValueInputOption("RAW").Do()
-		if err != nil {
-			return nil, fmt.Errorf("could not update last row id: %w", err)
+		if !dryRun {
+			rb := &sheets.ValueRange{
+				Values: [][]interface{}{{id + len(res.Values)}},
+			}
+			// Setting the same value again is safe to retry.
+			_, err = retryValue(ctx, serviceSheets, "bot state update", func(ctx context.Context) (*sheets.UpdateValuesResponse, error) {
+				return sheetsService.Spreadsheets.Values.Update(g.HostResponsesSheetID, g.HostResponsesBotSheet+"!B3:B3", rb).ValueInputOption("RAW").Context(ctx).Do()
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not update last row id: %w", err)
+			}
 		}
 
 		// get column titles for embed formatting
-		titlesRes, err := sheetsService.Spreadsheets.Values.Get(HostResponsesSheetID, fmt.Sprintf("%s!A1:M", HostResponsesSheet)).ValueRenderOption("UNFORMATTED_VALUE").Do()
+		titlesRes, err := retryValue(ctx, serviceSheets, "column titles", func(ctx context.Context) (*sheets.ValueRange, error) {
+			return sheetsService.Spreadsheets.Values.Get(g.HostResponsesSheetID, fmt.Sprintf("%s!A1:M", g.HostResponsesSheet)).ValueRenderOption("UNFORMATTED_VALUE").Context(ctx).Do()
+		})
 		if err != nil {
 			return nil, fmt.Errorf("could not get column titles from host responses sheet: %w", err)
 		}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+// testEnv is a guild backed by a fake Discord and a fake website which also
+// serves the YouTube playlist.
+type testEnv struct {
+	Guild   *GuildConfig
+	Discord *fakeDiscord
+
+	CurrentProjects *discordgo.Channel
+	TechTeam        *discordgo.Channel
+	MusicTeam       *discordgo.Channel
+
+	website  []websiteProject
+	releases []string // video IDs on the releases page
+	playlist []playlistVideo
+}
+
+type websiteProject struct {
+	ID       string
+	Deadline time.Time
+	Links    []string
+	NoPage   bool // only linked from the homepage
+}
+
+type playlistVideo struct {
+	ID    string
+	Title string
+}
+
+// newTestEnv sets up the global config for a test guild and restores it when
+// the test finishes.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	oldCfg, oldCache, oldYT, oldStore := cfg, webCache, yt, store
+	t.Cleanup(func() { cfg, webCache, yt, store = oldCfg, oldCache, oldYT, oldStore })
+	cfg = DefaultConfig()
+	cfg.RequestsPerHost = 1000
+	webCache = nil
+	yt = nil
+	store = nil
+
+	e := &testEnv{Discord: newFakeDiscord("100")}
+	site := httptest.NewServer(http.HandlerFunc(e.serveWebsite))
+	t.Cleanup(site.Close)
+
+	e.CurrentProjects = e.Discord.AddChannel("current-projects")
+	e.TechTeam = e.Discord.AddChannel("tech-team")
+	e.MusicTeam = e.Discord.AddChannel("music-team")
+
+	g := newGuildConfig()
+	g.Name = "test"
+	g.GuildID = "100"
+	g.WebsiteURL = site.URL
+	g.TechTeamRoleID = "200"
+	g.TechTeamChannelID = e.TechTeam.ID
+	g.MusicTeamChannelID = e.MusicTeam.ID
+	g.PlaylistID = "PLtest"
+	g.applyDefaults()
+	cfg.Guilds = []*GuildConfig{g}
+	e.Guild = g
+
+	var err error
+	yt, err = youtube.NewService(context.Background(), option.WithEndpoint(site.URL+"/"), option.WithHTTPClient(site.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// OpenStore sets up an empty state store.
+func (e *testEnv) OpenStore(t *testing.T) {
+	t.Helper()
+	s, err := OpenStore(filepath.Join(t.TempDir(), "uvebot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	store = s
+}
+
+// ListProject creates a project channel and announces it in
+// #current-projects. The announcement is posted a while before the deadline
+// as the year of the deadline is derived from the message time.
+func (e *testEnv) ListProject(id string, deadline time.Time, extra ...string) *discordgo.Channel {
+	c := e.Discord.AddChannel(id)
+	lines := append([]string{
+		strings.ToUpper(id),
+		"Deadline: " + deadline.Format("January 2"),
+		"<#" + c.ID + ">",
+	}, extra...)
+	e.Discord.Post(e.CurrentProjects.ID, strings.Join(lines, "\n"), deadline.AddDate(0, 0, -20))
+	return c
+}
+
+// WebsiteProject adds a project to the homepage with the given links on its
+// project page.
+func (e *testEnv) WebsiteProject(id string, deadline time.Time, links ...string) {
+	e.website = append(e.website, websiteProject{ID: id, Deadline: deadline, Links: links})
+}
+
+func (e *testEnv) serveWebsite(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		fmt.Fprint(w, "<html><body><h1>Current Projects</h1>")
+		for _, p := range e.website {
+			fmt.Fprintf(w, `<p><a href="/projects/%s">Due %s - %s</a></p>`, p.ID, p.Deadline.Format("January 2"), strings.ToUpper(p.ID))
+		}
+		fmt.Fprint(w, "</body></html>")
+	case strings.HasPrefix(r.URL.Path, "/projects/"):
+		id := strings.TrimPrefix(r.URL.Path, "/projects/")
+		for _, p := range e.website {
+			if p.ID != id || p.NoPage {
+				continue
+			}
+			fmt.Fprintf(w, `<html><body><div role="main"><section><h1>%s</h1></section><section>`, strings.ToUpper(id))
+			for _, l := range p.Links {
+				fmt.Fprintf(w, `<p><a href="%s">link</a></p>`, html.EscapeString(l))
+			}
+			fmt.Fprint(w, "</section></div></body></html>")
+			return
+		}
+		http.NotFound(w, r)
+	case r.URL.Path == "/released-performances":
+		fmt.Fprint(w, "<html><body>")
+		for _, id := range e.releases {
+			fmt.Fprintf(w, `<a href="https://www.youtube.com/watch?v=%s">watch</a>`, id)
+		}
+		fmt.Fprint(w, "</body></html>")
+	case r.URL.Path == "/youtube/v3/playlistItems":
+		var res youtube.PlaylistItemListResponse
+		for _, v := range e.playlist {
+			res.Items = append(res.Items, &youtube.PlaylistItem{
+				Snippet:        &youtube.PlaylistItemSnippet{Title: v.Title},
+				ContentDetails: &youtube.PlaylistItemContentDetails{VideoId: v.ID},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// runTestChecks runs the named checks for the test guild.
+func (e *testEnv) runTestChecks(t *testing.T, names ...string) ([]Finding, []CheckFailure) {
+	t.Helper()
+	var checks []Check
+	for _, name := range names {
+		c := lookupCheck(name)
+		if c == nil {
+			t.Fatalf("unknown check %s", name)
+		}
+		checks = append(checks, c)
+	}
+	return runChecks(context.Background(), newCheckData(e.Discord, e.Guild), checks)
+}
+
+// findingKeys returns "kind subject" for every finding, sorted.
+func findingKeys(findings []Finding) []string {
+	keys := []string{}
+	for _, f := range findings {
+		keys = append(keys, string(f.Kind)+" "+f.Subject)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func assertFindings(t *testing.T, findings []Finding, want ...string) {
+	t.Helper()
+	if want == nil {
+		want = []string{}
+	}
+	sort.Strings(want)
+	if got := findingKeys(findings); !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %q, want %q", got, want)
+	}
+}
+
+func assertNoFailures(t *testing.T, failures []CheckFailure) {
+	t.Helper()
+	if len(failures) > 0 {
+		t.Errorf("unexpected failures: %+v", failures)
+	}
+}
+
+// day returns the date days from today, without time of day.
+func day(days int) time.Time {
+	now := time.Now().AddDate(0, 0, days)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func TestGetCurrentProjects(t *testing.T) {
+	e := newTestEnv(t)
+	e.ListProject("later", day(20))
+	e.ListProject("sooner", day(5), "Status: Accepting Recordings")
+	e.Discord.Post(e.CurrentProjects.ID, "CHAMBER\nDeadline: "+day(10).Format("January 2"), day(-10))
+	e.Discord.Post(e.CurrentProjects.ID, "BROKEN\nDeadline: soon", day(-10))
+
+	projects, err := getCurrentProjects(context.Background(), e.Discord, e.Guild, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range projects {
+		got = append(got, fmt.Sprintf("%s %s %s", p.ID, p.Deadline.Format("2006-01-02"), p.Status))
+	}
+	want := []string{
+		"sooner " + day(5).Format("2006-01-02") + " Accepting Recordings",
+		"later " + day(20).Format("2006-01-02") + " ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("projects = %q, want %q", got, want)
+	}
+
+	all, err := getCurrentProjects(context.Background(), e.Discord, e.Guild, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("got %d projects with all, want 3 including the chamber project", len(all))
+	}
+}
+
+func TestGetCurrentProjectsMissingChannel(t *testing.T) {
+	e := newTestEnv(t)
+	e.CurrentProjects.Name = "projects"
+	if _, err := getCurrentProjects(context.Background(), e.Discord, e.Guild, false); err == nil {
+		t.Error("expected an error without #current-projects")
+	}
+}
+
+func TestDeadlineCheck(t *testing.T) {
+	e := newTestEnv(t)
+	e.ListProject("same", day(10))
+	e.WebsiteProject("same", day(10))
+	e.ListProject("moved", day(10))
+	e.WebsiteProject("moved", day(13))
+
+	findings, failures := e.runTestChecks(t, "deadline")
+	assertNoFailures(t, failures)
+	assertFindings(t, findings, "wrong-deadline moved")
+}
+
+func TestPassedDeadlineCheck(t *testing.T) {
+	e := newTestEnv(t)
+	e.ListProject("over", day(-10))
+	e.WebsiteProject("over", day(-10))
+	e.ListProject("extended", day(-10), "Status: Accepting Recordings")
+	e.WebsiteProject("extended", day(-10))
+	e.ListProject("running", day(10))
+	e.WebsiteProject("running", day(10))
+	e.ListProject("delisted", day(-10))
+
+	findings, failures := e.runTestChecks(t, "passed-deadline")
+	assertNoFailures(t, failures)
+	assertFindings(t, findings, "deadline-passed over")
+}
+
+func TestPinnedURLsCheck(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.ListProject("pinned", day(10))
+	e.Discord.Pin(c.ID, "Score: https://example.com/score.pdf.")
+	e.WebsiteProject("pinned", day(10),
+		"https://example.com/score.pdf",
+		"https://discord.gg/invite",
+		"https://www.google.com/url?q=https://example.com/track.mp3&sa=D",
+	)
+	broken := e.ListProject("broken", day(10))
+	e.Discord.Fail("ChannelMessagesPinned", broken.ID, errors.New("boom"))
+	e.WebsiteProject("broken", day(10), "https://example.com/other.pdf")
+
+	findings, failures := e.runTestChecks(t, "pinned-urls")
+	assertFindings(t, findings, "url-not-pinned pinned")
+	if len(findings) == 1 && !reflect.DeepEqual(findings[0].Links, []string{"https://example.com/track.mp3"}) {
+		t.Errorf("links = %q, want the unwrapped Google redirect", findings[0].Links)
+	}
+	if len(failures) != 1 || failures[0].Check != "pinned-urls" || !strings.Contains(failures[0].Error, "broken") {
+		t.Errorf("failures = %+v, want one for the broken project", failures)
+	}
+}
+
+func TestPinnedURLsCheckMissingPage(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.ListProject("fine", day(10))
+	e.Discord.Pin(c.ID, "https://example.com/fine.pdf")
+	e.WebsiteProject("fine", day(10), "https://example.com/fine.pdf", "https://example.com/new.pdf")
+	e.ListProject("gone", day(10))
+	e.website = append(e.website, websiteProject{ID: "gone", Deadline: day(10), NoPage: true})
+
+	findings, failures := e.runTestChecks(t, "pinned-urls")
+	assertFindings(t, findings, "url-not-pinned fine")
+	if len(failures) != 1 || !strings.Contains(failures[0].Error, "project page of gone") {
+		t.Errorf("failures = %+v, want one for the missing project page", failures)
+	}
+}
+
+func TestMissingProjectsCheck(t *testing.T) {
+	e := newTestEnv(t)
+	e.ListProject("both", day(10))
+	e.WebsiteProject("both", day(10))
+	e.WebsiteProject("website-only", day(10))
+	e.ListProject("discord-only", day(10))
+	e.ListProject("finished", day(-10))
+
+	findings, failures := e.runTestChecks(t, "missing-projects")
+	assertNoFailures(t, failures)
+	assertFindings(t, findings, "not-in-current-projects website-only", "missing-on-website discord-only")
+}
+
+func TestReleasesCheck(t *testing.T) {
+	e := newTestEnv(t)
+	e.releases = []string{"aaaaaaaaaa1", "aaaaaaaaaa2"}
+	e.playlist = []playlistVideo{
+		{ID: "aaaaaaaaaa1", Title: "Released"},
+		{ID: "aaaaaaaaaa3", Title: "Not on website"},
+		{ID: "aaaaaaaaaa4", Title: "Private video"},
+	}
+
+	findings, failures := e.runTestChecks(t, "releases")
+	assertNoFailures(t, failures)
+	assertFindings(t, findings, "release-missing-on-website aaaaaaaaaa3", "release-missing-in-playlist aaaaaaaaaa2")
+}
+
+func TestChecksWithoutDiscord(t *testing.T) {
+	e := newTestEnv(t)
+	e.WebsiteProject("project", day(10))
+
+	findings, failures := runChecks(context.Background(), newCheckData(nil, e.Guild), []Check{deadlineCheck{}})
+	assertFindings(t, findings)
+	if len(failures) != 1 || failures[0].Error != "no Discord session" {
+		t.Errorf("failures = %+v, want missing Discord session", failures)
+	}
+}
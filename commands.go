@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Dependency is an external service a command needs.
+type Dependency int
+
+const (
+	NeedsDiscord Dependency = 1 << iota // Discord session
+	NeedsYouTube                        // YouTube API client
+	NeedsSheets                         // Google Sheets API client
+	NeedsStore                          // local state store
+	UsesStore                           // local state store if available
+)
+
+// Command is a bot command. Every command is available on the command line,
+// as "!" text command and as slash command.
+type Command struct {
+	Name  string
+	Help  string // one line, also used as slash command description
+	Args  []Arg
+	Needs Dependency
+	Run   func(ctx context.Context, env *commandEnv) (*Result, error)
+}
+
+// Result is the output of a command.
+type Result struct {
+	Text     string         // Markdown for Discord and the command line
+	Findings []Finding      // findings of a check, rendered by the frontend if not nil
+	Failures []CheckFailure // checks that failed, also listed in Text
+	Hidden   int            // number of snoozed or acknowledged findings left out
+	Data     interface{}    // machine-readable result for --format json, nil if not supported
+}
+
+// Arg describes a command argument.
+type Arg struct {
+	Name     string
+	Help     string
+	Required bool
+	Flag     bool       // boolean flag given as --name instead of a positional value
+	Without  Dependency // dependencies the command doesn't need if the flag is set
+}
+
+// Args contains parsed argument values by name. Flags that are set have the
+// value "true".
+type Args map[string]string
+
+// Bool reports whether the flag is set.
+func (a Args) Bool(name string) bool {
+	return a[name] == "true"
+}
+
+// commandEnv is passed to running commands.
+type commandEnv struct {
+	Session discordSession // nil unless the command needs Discord
+	Guild   *GuildConfig
+	Args    Args
+	UserID  string // Discord user running the command, empty on the command line
+}
+
+// commands is the registry of all commands.
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{
+			Name: "help",
+			Help: "List all commands",
+			Run:  runHelp,
+		},
+		{
+			Name: "get-current-projects",
+			Help: "List the projects in #current-projects",
+			Args: []Arg{
+				{Name: "all", Help: "include entries without a deadline or channel, e.g. chamber projects", Flag: true},
+			},
+			Needs: NeedsDiscord,
+			Run:   runGetCurrentProjects,
+		},
+		{
+			Name: "get-website-projects",
+			Help: "List the projects on the website",
+			Run:  runGetWebsiteProjects,
+		},
+		{
+			Name:  "check-projects",
+			Help:  "Compare #current-projects with the website",
+			Needs: NeedsDiscord | UsesStore,
+			Run:   runCheckProjects,
+		},
+		{
+			Name: "check-project",
+			Help: "Compare a single project in #current-projects with the website",
+			Args: []Arg{
+				{Name: "slug", Help: "channel name / URL slug of the project", Required: true},
+			},
+			Needs: NeedsDiscord | UsesStore,
+			Run:   runCheckProject,
+		},
+		{
+			Name:  "check-releases",
+			Help:  "Compare the website releases with the YouTube playlist",
+			Needs: NeedsYouTube | UsesStore,
+			Run:   runCheckReleases,
+		},
+		{
+			Name: "snooze",
+			Help: "Stop reporting a finding for some days",
+			Args: []Arg{
+				{Name: "finding", Help: "ID of the finding as shown in reports", Required: true},
+				{Name: "days", Help: "number of days, 0 to acknowledge permanently", Required: true},
+			},
+			Needs: NeedsStore,
+			Run:   runSnooze,
+		},
+		{
+			Name: "unsnooze",
+			Help: "Report a snoozed or acknowledged finding again",
+			Args: []Arg{
+				{Name: "finding", Help: "ID of the finding as shown in reports", Required: true},
+			},
+			Needs: NeedsStore,
+			Run:   runUnsnooze,
+		},
+		{
+			Name: "check-host-responses",
+			Help: "Create channels for new host responses",
+			Args: []Arg{
+				{Name: "dry-run", Help: "only show what would be done, without changing the sheet or Discord", Flag: true, Without: NeedsDiscord | UsesStore},
+			},
+			Needs: NeedsDiscord | NeedsSheets | UsesStore,
+			Run:   runCheckHostResponses,
+		},
+	}
+}
+
+// lookupCommand returns the command with the given name or nil.
+func lookupCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// isCommand reports whether name is one of the bot's commands.
+func isCommand(name string) bool {
+	return lookupCommand(name) != nil
+}
+
+// Usage returns the command with its arguments, e.g. "check-project <slug>".
+func (cmd *Command) Usage() string {
+	var b strings.Builder
+	b.WriteString(cmd.Name)
+	for _, arg := range cmd.Args {
+		if arg.Flag {
+			fmt.Fprintf(&b, " [--%s]", arg.Name)
+		} else if arg.Required {
+			fmt.Fprintf(&b, " <%s>", arg.Name)
+		} else {
+			fmt.Fprintf(&b, " [%s]", arg.Name)
+		}
+	}
+	return b.String()
+}
+
+// ApplicationCommand returns the slash command definition.
+func (cmd *Command) ApplicationCommand() *discordgo.ApplicationCommand {
+	ac := &discordgo.ApplicationCommand{
+		Name:        cmd.Name,
+		Description: cmd.Help,
+	}
+	for _, arg := range cmd.Args {
+		opt := &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        arg.Name,
+			Description: arg.Help,
+			Required:    arg.Required,
+		}
+		if arg.Flag {
+			opt.Type = discordgo.ApplicationCommandOptionBoolean
+		}
+		ac.Options = append(ac.Options, opt)
+	}
+	return ac
+}
+
+// ParseArgs parses command line style arguments. Flags are written as --name
+// and may appear anywhere, the remaining words are assigned to the positional
+// arguments in order.
+func (cmd *Command) ParseArgs(words []string) (Args, error) {
+	args := make(Args)
+	var positional []string
+	for _, word := range words {
+		if strings.HasPrefix(word, "--") {
+			name := word[2:]
+			arg := cmd.arg(name)
+			if arg == nil || !arg.Flag {
+				return nil, fmt.Errorf("unknown flag --%s for %s", name, cmd.Usage())
+			}
+			args[name] = "true"
+		} else {
+			positional = append(positional, word)
+		}
+	}
+	for _, arg := range cmd.Args {
+		if arg.Flag {
+			continue
+		}
+		if len(positional) == 0 {
+			if arg.Required {
+				return nil, fmt.Errorf("missing argument <%s> for %s", arg.Name, cmd.Usage())
+			}
+			continue
+		}
+		args[arg.Name] = positional[0]
+		positional = positional[1:]
+	}
+	if len(positional) > 0 {
+		return nil, fmt.Errorf("too many arguments for %s", cmd.Usage())
+	}
+	return args, nil
+}
+
+// splitWords splits a text command into words like a shell. Double quotes
+// group words with spaces, e.g. !check-project "some project".
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// OptionArgs converts slash command options to arguments.
+func (cmd *Command) OptionArgs(options []*discordgo.ApplicationCommandInteractionDataOption) Args {
+	args := make(Args)
+	for _, opt := range options {
+		switch opt.Type {
+		case discordgo.ApplicationCommandOptionBoolean:
+			if opt.BoolValue() {
+				args[opt.Name] = "true"
+			}
+		case discordgo.ApplicationCommandOptionString:
+			args[opt.Name] = opt.StringValue()
+		}
+	}
+	return args
+}
+
+func (cmd *Command) arg(name string) *Arg {
+	for i := range cmd.Args {
+		if cmd.Args[i].Name == name {
+			return &cmd.Args[i]
+		}
+	}
+	return nil
+}
+
+// slashCommands returns the slash command definitions of all commands.
+func slashCommands() []*discordgo.ApplicationCommand {
+	var res []*discordgo.ApplicationCommand
+	for _, cmd := range commands {
+		res = append(res, cmd.ApplicationCommand())
+	}
+	return res
+}
+
+// NeedsFor returns the dependencies of the command when run with args.
+func (cmd *Command) NeedsFor(args Args) Dependency {
+	needs := cmd.Needs
+	for _, arg := range cmd.Args {
+		if arg.Flag && args.Bool(arg.Name) {
+			needs &^= arg.Without
+		}
+	}
+	return needs
+}
+
+// runCommand checks the command's dependencies and runs it, limited to the
+// configured job timeout.
+func runCommand(ctx context.Context, cmd *Command, env *commandEnv) (*Result, error) {
+	needs := cmd.NeedsFor(env.Args)
+	if needs&NeedsDiscord != 0 && env.Session == nil {
+		return nil, fmt.Errorf("no Discord session")
+	}
+	if needs&NeedsYouTube != 0 && yt == nil {
+		return nil, fmt.Errorf("no YouTube credentials supplied")
+	}
+	if needs&NeedsSheets != 0 && sheetsService == nil {
+		return nil, fmt.Errorf("no Google Sheets credentials supplied")
+	}
+	if needs&NeedsStore != 0 && store == nil {
+		return nil, fmt.Errorf("no state store")
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.jobTimeout())
+	defer cancel()
+	slog.Info("running command", "guild", env.Guild.Name, "command", cmd.Name, "args", env.Args, "user", env.UserID)
+	res, err := cmd.Run(ctx, env)
+	metricCommands.WithLabelValues(env.Guild.Name, cmd.Name, resultLabel(err)).Inc()
+	if err != nil {
+		slog.Warn("command failed", "guild", env.Guild.Name, "command", cmd.Name, "error", err)
+	}
+	return res, err
+}
+
+func runHelp(ctx context.Context, env *commandEnv) (*Result, error) {
+	var msg strings.Builder
+	for _, cmd := range commands {
+		fmt.Fprintf(&msg, "- `!%s`: %s\n", cmd.Usage(), cmd.Help)
+		for _, arg := range cmd.Args {
+			name := arg.Name
+			if arg.Flag {
+				name = "--" + name
+			}
+			fmt.Fprintf(&msg, "  - `%s`: %s\n", name, arg.Help)
+		}
+	}
+	return &Result{Text: msg.String()}, nil
+}
+
+func runGetCurrentProjects(ctx context.Context, env *commandEnv) (*Result, error) {
+	projects, err := getCurrentProjects(ctx, env.Session, env.Guild, env.Args.Bool("all"))
+	if err != nil {
+		return nil, err
+	}
+	var msg strings.Builder
+	for _, project := range projects {
+		if project.ID == "" {
+			fmt.Fprintf(&msg, "- %s (no channel)\n", project.Name)
+			continue
+		}
+		fmt.Fprintf(&msg, "- %s due %s\n", project.ID, project.Deadline.Format("2006-01-02"))
+	}
+	return &Result{Text: msg.String(), Data: projects}, nil
+}
+
+func runGetWebsiteProjects(ctx context.Context, env *commandEnv) (*Result, error) {
+	projects, err := getWebsiteProjects(ctx, env.Guild)
+	if err != nil {
+		return nil, err
+	}
+	var msg strings.Builder
+	for _, project := range projects {
+		fmt.Fprintf(&msg, "- %s due %s\n", project.ID, project.Deadline.Format("2006-01-02"))
+	}
+	return &Result{Text: msg.String(), Data: projects}, nil
+}
+
+// projectChecks are the checks run by check-projects and check-project.
+var projectChecks = []string{"deadline", "passed-deadline", "pinned-urls", "missing-projects"}
+
+func runCheckProjects(ctx context.Context, env *commandEnv) (*Result, error) {
+	return runEnabledChecks(ctx, newCheckData(env.Session, env.Guild), projectChecks...)
+}
+
+func runCheckProject(ctx context.Context, env *commandEnv) (*Result, error) {
+	d := newCheckData(env.Session, env.Guild)
+	d.Only = env.Args["slug"]
+	projects, err := d.DiscordProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	website, err := d.WebsiteProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 && len(website) == 0 {
+		return nil, fmt.Errorf("unknown project %s", d.Only)
+	}
+	return runEnabledChecks(ctx, d, projectChecks...)
+}
+
+func runCheckReleases(ctx context.Context, env *commandEnv) (*Result, error) {
+	return runEnabledChecks(ctx, newCheckData(env.Session, env.Guild), "releases")
+}
+
+// runEnabledChecks runs the named checks unless they are disabled for the
+// guild.
+func runEnabledChecks(ctx context.Context, d *checkData, names ...string) (*Result, error) {
+	checks := enabledChecks(d.Guild, names...)
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("%s disabled for this guild", strings.Join(names, ", "))
+	}
+	findings, failures := runChecks(ctx, d, checks)
+	if len(findings) == 0 && len(failedChecks(failures)) == len(checks) {
+		return nil, failuresError(failures)
+	}
+	return findingsResult(d.Guild, findings, failures), nil
+}
+
+// findingsResult lists the findings of checks that weren't acknowledged,
+// followed by the checks that failed.
+func findingsResult(g *GuildConfig, findings []Finding, failures []CheckFailure) *Result {
+	findings, hidden := filterAcknowledged(g, findings)
+	res := renderFindingsMarkdown(findings)
+	if res == "" && len(failures) == 0 {
+		res = "All good!"
+	}
+	if hidden > 0 {
+		res += "\n" + hiddenNote(hidden)
+	}
+	if len(failures) > 0 {
+		res += "\n" + renderFailuresMarkdown(failures)
+	}
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return &Result{Text: strings.TrimPrefix(res, "\n"), Findings: findings, Failures: failures, Hidden: hidden, Data: findings}
+}
+
+// hiddenNote tells how many findings were left out because they are snoozed.
+func hiddenNote(hidden int) string {
+	return fmt.Sprintf("(%d snoozed or acknowledged findings not shown)", hidden)
+}
+
+func runCheckHostResponses(ctx context.Context, env *commandEnv) (*Result, error) {
+	if env.Guild.HostResponsesSheetID == "" {
+		return nil, fmt.Errorf("no host responses sheet configured for this guild")
+	}
+	dryRun := env.Args.Bool("dry-run")
+	responses, err := checkHostResponses(ctx, sheetsService, env.Guild, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return &Result{Text: describeHostResponses(env.Guild, responses)}, nil
+	}
+	res := ""
+	for _, response := range responses {
+		channel, err := createProposedProjectChannel(env.Session, env.Guild, &response)
+		if err != nil {
+			return nil, err
+		}
+		res += response.Message + fmt.Sprintf(" <#%s>\n", channel.ID)
+	}
+	return &Result{Text: res}, nil
+}
+
+// describeHostResponses shows what check-host-responses would do.
+func describeHostResponses(g *GuildConfig, responses []hostResponse) string {
+	if len(responses) == 0 {
+		return "No new host responses."
+	}
+	var msg strings.Builder
+	msg.WriteString("Dry run, nothing was changed.\n")
+	for _, response := range responses {
+		fmt.Fprintf(&msg, "- %s\n", response.Message)
+		fmt.Fprintf(&msg, "  would create #%s in <#%s> with topic %q\n", response.Slug, g.HostResponsesCategID, response.Name)
+		fmt.Fprintf(&msg, "  and announce it in <#%s>\n", g.MusicTeamChannelID)
+		msg.WriteString("  embed:\n")
+		for _, field := range hostResponseEmbed(&response).Fields {
+			fmt.Fprintf(&msg, "  - %s: %s\n", field.Name, field.Value)
+		}
+	}
+	return msg.String()
+}
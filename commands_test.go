@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestParseArgs(t *testing.T) {
+	cmd := &Command{
+		Name: "test",
+		Args: []Arg{
+			{Name: "finding", Required: true},
+			{Name: "days"},
+			{Name: "dry-run", Flag: true},
+		},
+	}
+	tests := []struct {
+		words []string
+		want  Args // nil for an error
+	}{
+		{[]string{"abc"}, Args{"finding": "abc"}},
+		{[]string{"abc", "7"}, Args{"finding": "abc", "days": "7"}},
+		{[]string{"--dry-run", "abc"}, Args{"finding": "abc", "dry-run": "true"}},
+		{[]string{"abc", "--dry-run", "7"}, Args{"finding": "abc", "days": "7", "dry-run": "true"}},
+		{[]string{"some project"}, Args{"finding": "some project"}},
+		{nil, nil},                          // missing required argument
+		{[]string{"--dry-run"}, nil},        // flags don't count as positional
+		{[]string{"abc", "--force"}, nil},   // unknown flag
+		{[]string{"--finding", "abc"}, nil}, // not a flag
+		{[]string{"abc", "7", "8"}, nil},    // too many arguments
+	}
+	for _, tt := range tests {
+		got, err := cmd.ParseArgs(tt.words)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseArgs(%q) = %v, want an error", tt.words, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseArgs(%q) = %v, %v, want %v", tt.words, got, err, tt.want)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string // nil for an error
+	}{
+		{"!check-project foo", []string{"!check-project", "foo"}},
+		{"  !check-project \t foo\n", []string{"!check-project", "foo"}},
+		{`!check-project "some project"`, []string{"!check-project", "some project"}},
+		{`!snooze ab"c d"e 3`, []string{"!snooze", "abc de", "3"}},
+		{`!snooze "" 3`, []string{"!snooze", "", "3"}},
+		{`!check-project "unterminated`, nil},
+	}
+	for _, tt := range tests {
+		got, err := splitWords(tt.s)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("splitWords(%q) = %q, want an error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestOptionArgs(t *testing.T) {
+	option := func(name string, typ discordgo.ApplicationCommandOptionType, value interface{}) *discordgo.ApplicationCommandInteractionDataOption {
+		return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: typ, Value: value}
+	}
+	cmd := lookupCommand("check-host-responses")
+	tests := []struct {
+		options []*discordgo.ApplicationCommandInteractionDataOption
+		want    Args
+	}{
+		{nil, Args{}},
+		{
+			[]*discordgo.ApplicationCommandInteractionDataOption{option("dry-run", discordgo.ApplicationCommandOptionBoolean, true)},
+			Args{"dry-run": "true"},
+		},
+		{
+			[]*discordgo.ApplicationCommandInteractionDataOption{option("dry-run", discordgo.ApplicationCommandOptionBoolean, false)},
+			Args{},
+		},
+		{
+			[]*discordgo.ApplicationCommandInteractionDataOption{option("slug", discordgo.ApplicationCommandOptionString, "some-piece")},
+			Args{"slug": "some-piece"},
+		},
+	}
+	for _, tt := range tests {
+		if got := cmd.OptionArgs(tt.options); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OptionArgs(%v) = %v, want %v", tt.options, got, tt.want)
+		}
+	}
+
+	// Options parse the same as the equivalent text command and unset flags
+	// keep their dependencies.
+	args := cmd.OptionArgs([]*discordgo.ApplicationCommandInteractionDataOption{option("dry-run", discordgo.ApplicationCommandOptionBoolean, true)})
+	parsed, err := cmd.ParseArgs([]string{"--dry-run"})
+	if err != nil || !reflect.DeepEqual(args, parsed) {
+		t.Errorf("OptionArgs = %v, ParseArgs = %v, %v", args, parsed, err)
+	}
+	if cmd.NeedsFor(args)&NeedsDiscord != 0 || cmd.NeedsFor(Args{})&NeedsDiscord == 0 {
+		t.Error("--dry-run should drop the Discord dependency")
+	}
+}
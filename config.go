@@ -1,21 +1,406 @@
 package main
 
-const (
-	WebsiteURL            = "https://www.untitledvirtualensemble.org"      // URL of the UVE website
-	WebsiteReleasesURL    = WebsiteURL + "/released-performances"          // URL of the releases page of the UVE website
-	UVEGuildID            = "851213338481655878"                           // ID of the UVE guild
-	TechTeamRoleID        = "851304372976746497"                           // ID of the @Teach Team role
-	TechTeamChannelID     = "909798620281311312"                           // ID of the #tech-team channel
-	MusicTeamChannelID    = "857056459154128896"                           // ID of the #music-team channel
-	HonkChannelID         = "870342886745600021"                           // ID of the #geese-go-honk channel
-	StaffBotSpamChannelID = "924839541959983124"                           // ID of the #staff-bot-spam channel
-	UVEPlaylistID         = "PLhCTe78BMQ8VoO7aCZYrZpdBKqCEqvMMg"           // youtube playlist with all videos
-	HostResponsesCategID  = "1046543356123173015"                          // category for host responses discussion
-	HostResponsesSheetID  = "1-Lf5-y8Vvfj1IynA8hWG1wWBstXA5OpGLn5UGU2k4Ek" // spreadsheet id of host responses
-	HostResponsesSheet    = "Form Responses 1"                             // name of sheet with responses
-	HostResponsesBotSheet = "UVE Bot"                                      // name of sheet with bot state
-	CheckWebsiteSchedule  = "0 12 * * *"                                   // cron configuration for the website check
-	CheckHRSchedule       = "1 * * * *"                                    // cron configuration of the host responses sheet check
-	HonkChance            = 33                                             // chance to reply to a HONK in %
-	HonkDelay             = 30                                             // maximum delay until HONK reply in minutes
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
 )
+
+// Config contains the bot configuration. It is read from a JSON file, with
+// missing values taken from DefaultConfig.
+type Config struct {
+	GoogleKeyFile   string         `json:"google_key_file"`   // service account key for Google Sheets
+	StateFile       string         `json:"state_file"`        // database for the bot's local state
+	FetchWorkers    int            `json:"fetch_workers"`     // maximum number of concurrent fetches per check run
+	RequestsPerHost float64        `json:"requests_per_host"` // maximum website requests per second to a single host
+	CacheDir        string         `json:"cache_dir"`         // directory for cached website pages, empty to disable caching
+	RequestTimeout  int            `json:"request_timeout"`   // timeout for a single website, Discord or Google request in seconds
+	JobTimeout      int            `json:"job_timeout"`       // timeout for a command or cron job in seconds
+	LogFormat       string         `json:"log_format"`        // "text" or "json"
+	LogLevel        string         `json:"log_level"`         // "debug", "info", "warn" or "error"
+	MetricsAddr     string         `json:"metrics_addr"`      // listen address for /metrics and /healthz in bot mode, empty to disable
+	YouTubeEndpoint string         `json:"youtube_endpoint"`  // base URL of the YouTube API, e.g. of the fake server, empty for Google
+	SheetsEndpoint  string         `json:"sheets_endpoint"`   // base URL of the Sheets API, used without credentials if set
+	Guilds          []*GuildConfig `json:"guilds"`            // guilds the bot serves
+}
+
+// GuildConfig contains the settings for a single guild. Optional features are
+// disabled by leaving their IDs or schedules empty.
+type GuildConfig struct {
+	Name                  string `json:"name"`                      // short name for selecting the guild on the command line
+	GuildID               string `json:"guild_id"`                  // ID of the guild
+	WebsiteURL            string `json:"website_url"`               // URL of the ensemble website
+	WebsiteReleasesURL    string `json:"website_releases_url"`      // URL of the releases page, defaults to WebsiteURL + "/released-performances"
+	TechTeamRoleID        string `json:"tech_team_role_id"`         // ID of the @Teach Team role
+	TechTeamChannelID     string `json:"tech_team_channel_id"`      // ID of the #tech-team channel
+	MusicTeamChannelID    string `json:"music_team_channel_id"`     // ID of the #music-team channel
+	HonkChannelID         string `json:"honk_channel_id"`           // ID of the #geese-go-honk channel (optional)
+	StaffBotSpamChannelID string `json:"staff_bot_spam_channel_id"` // ID of the #staff-bot-spam channel
+	PlaylistID            string `json:"playlist_id"`               // youtube playlist with all videos (optional)
+	HostResponsesCategID  string `json:"host_responses_categ_id"`   // category for host responses discussion
+	HostResponsesSheetID  string `json:"host_responses_sheet_id"`   // spreadsheet id of host responses (optional)
+	HostResponsesSheet    string `json:"host_responses_sheet"`      // name of sheet with responses
+	HostResponsesBotSheet string `json:"host_responses_bot_sheet"`  // name of sheet with bot state
+	CheckWebsiteSchedule  string `json:"check_website_schedule"`    // default cron configuration for the website checks (optional)
+	CheckHRSchedule       string `json:"check_hr_schedule"`         // cron configuration of the host responses sheet check (optional)
+	HonkChance            int    `json:"honk_chance"`               // chance to reply to a HONK in %
+	HonkDelay             int    `json:"honk_delay"`                // maximum delay until HONK reply in minutes
+
+	// Permissions restricts commands to roles and channels, keyed by command
+	// name. Commands without an entry can be used by anyone. By default,
+	// check-host-responses and snoozing are restricted to the tech team; an
+	// entry only replaces the lists it sets, and null lifts the restriction.
+	Permissions map[string]*CommandPermission `json:"permissions"`
+
+	// Checks disables or reschedules individual website checks, keyed by
+	// check name. Checks without an entry run on CheckWebsiteSchedule.
+	Checks map[string]*CheckConfig `json:"checks"`
+}
+
+// CommandPermission restricts who may use a command and where. Empty lists
+// do not restrict.
+type CommandPermission struct {
+	Roles    []string `json:"roles"`    // the user needs at least one of these roles
+	Channels []string `json:"channels"` // the command can only be used in these channels
+}
+
+// CheckConfig contains the settings for a single check.
+type CheckConfig struct {
+	Disabled bool   `json:"disabled"` // don't run the check, neither scheduled nor by command
+	Schedule string `json:"schedule"` // cron configuration, defaults to check_website_schedule
+}
+
+// DefaultConfig returns the configuration used when no config file is given.
+func DefaultConfig() *Config {
+	uve := newGuildConfig()
+	uve.Name = "uve"
+	uve.GuildID = "851213338481655878"
+	uve.WebsiteURL = "https://www.untitledvirtualensemble.org"
+	uve.TechTeamRoleID = "851304372976746497"
+	uve.TechTeamChannelID = "909798620281311312"
+	uve.MusicTeamChannelID = "857056459154128896"
+	uve.HonkChannelID = "870342886745600021"
+	uve.StaffBotSpamChannelID = "924839541959983124"
+	uve.PlaylistID = "PLhCTe78BMQ8VoO7aCZYrZpdBKqCEqvMMg"
+	uve.HostResponsesCategID = "1046543356123173015"
+	uve.HostResponsesSheetID = "1-Lf5-y8Vvfj1IynA8hWG1wWBstXA5OpGLn5UGU2k4Ek"
+	return &Config{
+		GoogleKeyFile:   "google_key.json",
+		StateFile:       "uvebot.db",
+		FetchWorkers:    4,
+		RequestsPerHost: 2,
+		CacheDir:        "http-cache",
+		RequestTimeout:  30,
+		JobTimeout:      600,
+		LogFormat:       "text",
+		LogLevel:        "info",
+		Guilds:          []*GuildConfig{uve},
+	}
+}
+
+// newGuildConfig returns the defaults shared by all guilds.
+func newGuildConfig() *GuildConfig {
+	return &GuildConfig{
+		HostResponsesSheet:    "Form Responses 1",
+		HostResponsesBotSheet: "UVE Bot",
+		CheckWebsiteSchedule:  "0 12 * * *",
+		CheckHRSchedule:       "1 * * * *",
+		HonkChance:            33,
+		HonkDelay:             30,
+	}
+}
+
+// applyDefaults fills in defaults that depend on other guild settings.
+func (g *GuildConfig) applyDefaults() {
+	if g.WebsiteReleasesURL == "" && g.WebsiteURL != "" {
+		g.WebsiteReleasesURL = g.WebsiteURL + "/released-performances"
+	}
+	defaults := map[string]*CommandPermission{
+		"check-host-responses": {Roles: []string{g.TechTeamRoleID}},
+		"snooze":               {Roles: []string{g.TechTeamRoleID}},
+		"unsnooze":             {Roles: []string{g.TechTeamRoleID}},
+	}
+	if g.Permissions == nil {
+		g.Permissions = make(map[string]*CommandPermission)
+	}
+	for cmd, def := range defaults {
+		perm, ok := g.Permissions[cmd]
+		switch {
+		case !ok:
+			g.Permissions[cmd] = def
+		case perm != nil:
+			// Only the lists set in the config replace the defaults.
+			if perm.Roles == nil {
+				perm.Roles = def.Roles
+			}
+			if perm.Channels == nil {
+				perm.Channels = def.Channels
+			}
+		}
+	}
+}
+
+// requestTimeout returns RequestTimeout as duration.
+func (c *Config) requestTimeout() time.Duration {
+	return time.Duration(c.RequestTimeout) * time.Second
+}
+
+// jobTimeout returns JobTimeout as duration.
+func (c *Config) jobTimeout() time.Duration {
+	return time.Duration(c.JobTimeout) * time.Second
+}
+
+// logLevel returns the parsed LogLevel, defaulting to info.
+func (c *Config) logLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// checkConfig returns the settings for the named check with defaults applied.
+func (g *GuildConfig) checkConfig(name string) CheckConfig {
+	var c CheckConfig
+	if conf := g.Checks[name]; conf != nil {
+		c = *conf
+	}
+	if c.Schedule == "" {
+		c.Schedule = g.CheckWebsiteSchedule
+	}
+	return c
+}
+
+// cfg is the active configuration, set up in main.
+var cfg = DefaultConfig()
+
+// LoadConfig reads the config file at path. An empty path returns the default
+// configuration.
+func LoadConfig(path string) (*Config, error) {
+	c := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config: %w", err)
+		}
+		var raw struct {
+			GoogleKeyFile   *string           `json:"google_key_file"`
+			StateFile       *string           `json:"state_file"`
+			FetchWorkers    *int              `json:"fetch_workers"`
+			RequestsPerHost *float64          `json:"requests_per_host"`
+			CacheDir        *string           `json:"cache_dir"`
+			RequestTimeout  *int              `json:"request_timeout"`
+			JobTimeout      *int              `json:"job_timeout"`
+			LogFormat       *string           `json:"log_format"`
+			LogLevel        *string           `json:"log_level"`
+			MetricsAddr     *string           `json:"metrics_addr"`
+			YouTubeEndpoint *string           `json:"youtube_endpoint"`
+			SheetsEndpoint  *string           `json:"sheets_endpoint"`
+			Guilds          []json.RawMessage `json:"guilds"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("could not parse config %s: %w", path, err)
+		}
+		if raw.GoogleKeyFile != nil {
+			c.GoogleKeyFile = *raw.GoogleKeyFile
+		}
+		if raw.StateFile != nil {
+			c.StateFile = *raw.StateFile
+		}
+		if raw.FetchWorkers != nil {
+			c.FetchWorkers = *raw.FetchWorkers
+		}
+		if raw.RequestsPerHost != nil {
+			c.RequestsPerHost = *raw.RequestsPerHost
+		}
+		if raw.CacheDir != nil {
+			c.CacheDir = *raw.CacheDir
+		}
+		if raw.RequestTimeout != nil {
+			c.RequestTimeout = *raw.RequestTimeout
+		}
+		if raw.JobTimeout != nil {
+			c.JobTimeout = *raw.JobTimeout
+		}
+		if raw.LogFormat != nil {
+			c.LogFormat = *raw.LogFormat
+		}
+		if raw.LogLevel != nil {
+			c.LogLevel = *raw.LogLevel
+		}
+		if raw.MetricsAddr != nil {
+			c.MetricsAddr = *raw.MetricsAddr
+		}
+		if raw.YouTubeEndpoint != nil {
+			c.YouTubeEndpoint = *raw.YouTubeEndpoint
+		}
+		if raw.SheetsEndpoint != nil {
+			c.SheetsEndpoint = *raw.SheetsEndpoint
+		}
+		// Guilds from the file replace the default guild entirely.
+		if raw.Guilds != nil {
+			c.Guilds = nil
+		}
+		for i, data := range raw.Guilds {
+			g := newGuildConfig()
+			if err := json.Unmarshal(data, g); err != nil {
+				return nil, fmt.Errorf("could not parse config %s: guild %d: %w", path, i, err)
+			}
+			c.Guilds = append(c.Guilds, g)
+		}
+	}
+	for _, g := range c.Guilds {
+		g.applyDefaults()
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// Validate checks that all config values are usable.
+func (c *Config) Validate() error {
+	if c.GoogleKeyFile == "" {
+		return fmt.Errorf("google_key_file: must not be empty")
+	}
+	if c.StateFile == "" {
+		return fmt.Errorf("state_file: must not be empty")
+	}
+	if c.FetchWorkers < 1 {
+		return fmt.Errorf("fetch_workers: must be positive, got %d", c.FetchWorkers)
+	}
+	if c.RequestsPerHost <= 0 {
+		return fmt.Errorf("requests_per_host: must be positive, got %g", c.RequestsPerHost)
+	}
+	if c.RequestTimeout <= 0 {
+		return fmt.Errorf("request_timeout: must be positive, got %d", c.RequestTimeout)
+	}
+	if c.JobTimeout <= 0 {
+		return fmt.Errorf("job_timeout: must be positive, got %d", c.JobTimeout)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("log_format: must be text or json, got %q", c.LogFormat)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+	if len(c.Guilds) == 0 {
+		return fmt.Errorf("guilds: at least one guild is required")
+	}
+	seen := make(map[string]bool)
+	for i, g := range c.Guilds {
+		if err := g.Validate(); err != nil {
+			return fmt.Errorf("guild %d (%s): %w", i, g.Name, err)
+		}
+		if seen[g.GuildID] || seen[g.Name] {
+			return fmt.Errorf("guild %d (%s): duplicate guild", i, g.Name)
+		}
+		seen[g.GuildID] = true
+		seen[g.Name] = true
+	}
+	return nil
+}
+
+// Validate checks that all guild config values are usable.
+func (g *GuildConfig) Validate() error {
+	if g.Name == "" {
+		return fmt.Errorf("name: must not be empty")
+	}
+	for name, u := range map[string]string{
+		"website_url":          g.WebsiteURL,
+		"website_releases_url": g.WebsiteReleasesURL,
+	} {
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%s: not an absolute URL: %q", name, u)
+		}
+	}
+	for name, id := range map[string]string{
+		"guild_id":                  g.GuildID,
+		"tech_team_role_id":         g.TechTeamRoleID,
+		"tech_team_channel_id":      g.TechTeamChannelID,
+		"staff_bot_spam_channel_id": g.StaffBotSpamChannelID,
+	} {
+		if !isSnowflake(id) {
+			return fmt.Errorf("%s: not a Discord ID: %q", name, id)
+		}
+	}
+	if g.HonkChannelID != "" && !isSnowflake(g.HonkChannelID) {
+		return fmt.Errorf("honk_channel_id: not a Discord ID: %q", g.HonkChannelID)
+	}
+	if g.HostResponsesSheetID != "" {
+		for name, id := range map[string]string{
+			"music_team_channel_id":   g.MusicTeamChannelID,
+			"host_responses_categ_id": g.HostResponsesCategID,
+		} {
+			if !isSnowflake(id) {
+				return fmt.Errorf("%s: not a Discord ID: %q", name, id)
+			}
+		}
+		if g.HostResponsesSheet == "" || g.HostResponsesBotSheet == "" {
+			return fmt.Errorf("host_responses_sheet, host_responses_bot_sheet: must not be empty")
+		}
+	}
+	for name, spec := range map[string]string{
+		"check_website_schedule": g.CheckWebsiteSchedule,
+		"check_hr_schedule":      g.CheckHRSchedule,
+	} {
+		if spec == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	for name, conf := range g.Checks {
+		if lookupCheck(name) == nil {
+			return fmt.Errorf("checks: unknown check %q", name)
+		}
+		if conf == nil || conf.Schedule == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(conf.Schedule); err != nil {
+			return fmt.Errorf("checks: %s: %w", name, err)
+		}
+	}
+	if g.HonkChance < 0 || g.HonkChance > 100 {
+		return fmt.Errorf("honk_chance: must be between 0 and 100, got %d", g.HonkChance)
+	}
+	if g.HonkDelay <= 0 {
+		return fmt.Errorf("honk_delay: must be positive, got %d", g.HonkDelay)
+	}
+	for name, perm := range g.Permissions {
+		if !isCommand(name) {
+			return fmt.Errorf("permissions: unknown command %q", name)
+		}
+		if perm == nil {
+			continue
+		}
+		for _, id := range append(perm.Roles, perm.Channels...) {
+			if !isSnowflake(id) {
+				return fmt.Errorf("permissions: %s: not a Discord ID: %q", name, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Guild returns the config for the guild with the given ID or name, or nil if
+// the guild is not configured.
+func (c *Config) Guild(id string) *GuildConfig {
+	for _, g := range c.Guilds {
+		if g.GuildID == id || g.Name == id {
+			return g
+		}
+	}
+	return nil
+}
+
+func isSnowflake(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil
+}
@@ -1,66 +1,327 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/robfig/cron/v3"
 	"google.golang.org/api/sheets/v4"
-	"google.golang.org/api/youtube/v3"
 )
 
-// InitCron sets up the cronjobs.
-func InitCron(dg *discordgo.Session) *cron.Cron {
+// InitCron sets up the cronjobs for all configured guilds. Running jobs are
+// canceled when ctx is done.
+func InitCron(ctx context.Context, dg discordSession) *cron.Cron {
 	// cronjob setup
 	c := cron.New()
-	c.AddFunc(CheckWebsiteSchedule, func() { checkWebsiteCron(dg, yt) })
-	c.AddFunc(CheckHRSchedule, func() { checkHRCron(dg, sheetsService) })
+	for _, g := range cfg.Guilds {
+		g := g
+		for _, job := range checkJobs(dg, g) {
+			job := job
+			c.AddFunc(job.Schedule, func() {
+				runJob(ctx, g, job.Name, func(ctx context.Context) error { return checkWebsiteCron(ctx, dg, g, job) })
+			})
+		}
+		if g.CheckHRSchedule != "" && g.HostResponsesSheetID != "" && sheetsService != nil {
+			c.AddFunc(g.CheckHRSchedule, func() {
+				runJob(ctx, g, "check-host-responses", func(ctx context.Context) error { return checkHRCron(ctx, dg, sheetsService, g) })
+			})
+		}
+	}
 	c.Start()
 	return c
 }
 
-func checkWebsiteCron(s *discordgo.Session, yt *youtube.Service) {
-	projectsRes, err := checkCurrentProjects(s, UVEGuildID)
-	if err != nil {
-		s.ChannelMessageSend(TechTeamChannelID, fmt.Sprintf("!check-projects error: %s", err))
+// runJob runs a cron job limited to the configured job timeout and records it
+// in the job history.
+func runJob(ctx context.Context, g *GuildConfig, name string, job func(ctx context.Context) error) {
+	if ctx.Err() != nil {
+		// shutting down
 		return
 	}
-	releasesRes, err := checkReleases(yt)
+	ctx, cancel := context.WithTimeout(ctx, cfg.jobTimeout())
+	defer cancel()
+	log := slog.With("guild", g.Name, "job", name)
+	log.Info("running job")
+	run := &JobRun{Job: name, Start: time.Now()}
+	err := job(ctx)
+	run.End = time.Now()
+	metricJobDuration.WithLabelValues(g.Name, name).Observe(run.End.Sub(run.Start).Seconds())
 	if err != nil {
-		s.ChannelMessageSend(TechTeamChannelID, fmt.Sprintf("!check-releases error: %s", err))
-		return
+		run.Error = err.Error()
+		log.Error("job failed", "error", err)
+	} else {
+		metricJobLastSuccess.WithLabelValues(g.Name, name).Set(float64(run.End.Unix()))
+		health.JobSucceeded(g, name, run.End)
+	}
+	log.Info("job finished", "duration", run.End.Sub(run.Start))
+	if err := store.AddJobRun(g.GuildID, run); err != nil {
+		log.Error("could not record job run", "error", err)
+	}
+}
+
+// checkJob runs the checks that share a schedule.
+type checkJob struct {
+	Name     string
+	Schedule string
+	Checks   []Check
+}
+
+// checkJobs groups the enabled checks of a guild by schedule. Checks whose
+// data sources aren't available are skipped. Checks on the default schedule
+// run in the "check-website" job, the other jobs are named after their checks.
+func checkJobs(s discordSession, g *GuildConfig) []*checkJob {
+	var jobs []*checkJob
+	bySchedule := make(map[string]*checkJob)
+	for _, c := range enabledChecks(g) {
+		if err := newCheckData(s, g).Available(c.Sources()); err != nil {
+			slog.Info("not scheduling check", "guild", g.Name, "check", c.Name(), "reason", err)
+			continue
+		}
+		schedule := g.checkConfig(c.Name()).Schedule
+		if schedule == "" {
+			continue
+		}
+		job, ok := bySchedule[schedule]
+		if !ok {
+			job = &checkJob{Schedule: schedule}
+			bySchedule[schedule] = job
+			jobs = append(jobs, job)
+		}
+		job.Checks = append(job.Checks, c)
+	}
+	for _, job := range jobs {
+		if job.Schedule == g.CheckWebsiteSchedule {
+			job.Name = "check-website"
+			continue
+		}
+		var names []string
+		for _, c := range job.Checks {
+			names = append(names, c.Name())
+		}
+		job.Name = "check-" + strings.Join(names, "+")
+	}
+	return jobs
+}
+
+// findingsJob is the name under which the open findings of a check are
+// stored.
+func findingsJob(check string) string {
+	return "check:" + check
+}
+
+func checkWebsiteCron(ctx context.Context, s discordSession, g *GuildConfig, job *checkJob) error {
+	findings, failures := runChecks(ctx, newCheckData(s, g), job.Checks)
+	if err := ctx.Err(); err != nil {
+		// The results are incomplete, so don't report anything.
+		return err
+	}
+	// Open findings are stored per check since checks may run in different
+	// jobs.
+	prev := make(map[string]Finding)
+	for _, c := range job.Checks {
+		open, err := store.OpenFindings(g.GuildID, findingsJob(c.Name()))
+		if err != nil {
+			return err
+		}
+		for key, f := range open {
+			prev[key] = f
+		}
+	}
+	// A failed check may have skipped the subjects of its open findings, so
+	// they stay open instead of being reported as resolved.
+	failed := failedChecks(failures)
+	found := make(map[string]bool)
+	for _, f := range findings {
+		found[f.Key()] = true
+	}
+	for key, f := range prev {
+		if failed[f.Check] && !found[key] {
+			findings = append(findings, f)
+		}
+	}
+	sortFindings(findings)
+	// Acknowledged findings are neither reported nor remembered as open, so
+	// they are reported as new once a snooze expires. They are not resolved
+	// though.
+	visible, _ := filterAcknowledged(g, findings)
+	added, open, _ := diffFindings(prev, visible)
+	_, _, resolved := diffFindings(prev, findings)
+
+	// New or changed findings and failures are posted as one report. Only
+	// new or changed findings ping the tech team. The stored report is
+	// Markdown only.
+	var res, content string
+	if len(added) > 0 {
+		res = fmt.Sprintf("<@&%s>\n%s", g.TechTeamRoleID, renderFindingsMarkdown(added))
+		content = fmt.Sprintf("<@&%s> %d new or changed:\n", g.TechTeamRoleID, len(added))
+	}
+	if len(failures) > 0 {
+		res += renderFailuresMarkdown(failures)
+		content += renderFailuresMarkdown(failures)
 	}
-	res := projectsRes + releasesRes
 	if res != "" {
-		s.ChannelMessageSend(TechTeamChannelID, fmt.Sprintf("<@&%s>\n%s", TechTeamRoleID, res))
+		err := sendMessage(s, g.TechTeamChannelID, findingsMessage(content, added))
+		if err != nil {
+			// The findings aren't stored, so they are reported again in
+			// the next run.
+			return fmt.Errorf("could not post report: %w", err)
+		}
+	}
+	var errs partErrors
+	if len(resolved) > 0 {
+		err := sendMessage(s, g.TechTeamChannelID, &discordgo.MessageSend{
+			Content:         "Resolved:\n" + renderFindingsMarkdown(resolved),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err != nil {
+			errs.add(fmt.Errorf("could not post resolved findings: %w", err))
+		}
 	}
+
+	byCheck := make(map[string][]Finding)
+	for _, f := range visible {
+		byCheck[f.Check] = append(byCheck[f.Check], f)
+	}
+	for _, c := range job.Checks {
+		if err := store.SetOpenFindings(g.GuildID, findingsJob(c.Name()), byCheck[c.Name()]); err != nil {
+			return err
+		}
+		metricFindings.WithLabelValues(g.Name, c.Name()).Set(float64(len(byCheck[c.Name()])))
+	}
+	if len(added) > 0 || len(resolved) > 0 {
+		// The summary also lists the open findings of checks in other jobs.
+		inJob := make(map[string]bool)
+		for _, c := range job.Checks {
+			inJob[c.Name()] = true
+		}
+		for _, c := range enabledChecks(g) {
+			if inJob[c.Name()] {
+				continue
+			}
+			other, err := store.OpenFindings(g.GuildID, findingsJob(c.Name()))
+			if err != nil {
+				return err
+			}
+			for _, f := range other {
+				open = append(open, f)
+			}
+		}
+		sortFindings(open)
+		updateOpenSummary(s, g, "check-website", open)
+	}
+	if err := store.AddReport(g.GuildID, &Report{Job: job.Name, Time: time.Now(), Content: res}); err != nil {
+		return err
+	}
+	errs.add(failuresError(failures))
+	return errs.err()
 }
 
-func checkHRCron(s *discordgo.Session, sheetsService *sheets.Service) {
-	responses, err := checkHostResponses(sheetsService)
+// updateOpenSummary keeps a single message in #tech-team listing the findings
+// that are still open. The message is edited in place so that it doesn't ping
+// anyone.
+func updateOpenSummary(s discordSession, g *GuildConfig, job string, open []Finding) {
+	content := "No previously reported issues are still open."
+	if len(open) > 0 {
+		content = fitMessage(fmt.Sprintf("Still open from earlier reports (%d):\n%s", len(open), renderFindingsMarkdown(open)))
+	}
+	cursor := job + "-summary"
+	msgID, err := store.Cursor(g.GuildID, cursor)
 	if err != nil {
-		s.ChannelMessageSend(TechTeamChannelID, fmt.Sprintf("!check-host-responses error: %s", err))
+		slog.Warn("could not get summary message", "guild", g.Name, "job", job, "error", err)
+	}
+	if msgID != "" {
+		_, err = s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:              msgID,
+			Channel:         g.TechTeamChannelID,
+			Content:         &content,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err == nil {
+			return
+		}
+		// The message was probably deleted, post a new one.
+	}
+	msg, err := s.ChannelMessageSendComplex(g.TechTeamChannelID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		slog.Warn("could not post summary message", "guild", g.Name, "job", job, "error", err)
 		return
 	}
+	if err := store.SetCursor(g.GuildID, cursor, msg.ID); err != nil {
+		slog.Warn("could not save summary message", "guild", g.Name, "job", job, "error", err)
+	}
+}
+
+func checkHRCron(ctx context.Context, s discordSession, sheetsService *sheets.Service, g *GuildConfig) error {
+	reportErr := func(err error) {
+		if _, sendErr := s.ChannelMessageSend(g.TechTeamChannelID, truncate(fmt.Sprintf("!check-host-responses error: %s", err), messageLimit)); sendErr != nil {
+			slog.Error("could not report error", "guild", g.Name, "job", "check-host-responses", "error", sendErr)
+		}
+	}
+	responses, err := checkHostResponses(ctx, sheetsService, g, false)
+	if err != nil {
+		reportErr(err)
+		return err
+	}
+	// The sheet was already advanced, so channels are created for all
+	// responses even if ctx is canceled in the meantime.
+	var firstErr error
 	for _, response := range responses {
-		channel, err := createProposedProjectChannel(s, &response)
+		channel, err := createProposedProjectChannel(s, g, &response)
+		if err == nil {
+			err = sendMessage(s, g.MusicTeamChannelID, &discordgo.MessageSend{Content: response.Message + fmt.Sprintf(" <#%s>", channel.ID)})
+			if err != nil {
+				err = fmt.Errorf("could not announce #%s: %w", channel.Name, err)
+			}
+		}
 		if err != nil {
-			s.ChannelMessageSend(TechTeamChannelID, fmt.Sprintf("!check-host-responses error: %s", err))
+			reportErr(err)
+			if firstErr == nil {
+				firstErr = err
+			}
 		}
-		s.ChannelMessageSend(MusicTeamChannelID, response.Message+fmt.Sprintf(" <#%s>", channel.ID))
 	}
+	return firstErr
 }
 
-func createProposedProjectChannel(s *discordgo.Session, response *hostResponse) (*discordgo.Channel, error) {
-	channel, err := s.GuildChannelCreateComplex(UVEGuildID, discordgo.GuildChannelCreateData{
+func createProposedProjectChannel(s discordSession, g *GuildConfig, response *hostResponse) (channel *discordgo.Channel, err error) {
+	defer func() { metricHostResponses.WithLabelValues(g.Name, resultLabel(err)).Inc() }()
+	channel, err = s.GuildChannelCreateComplex(g.GuildID, discordgo.GuildChannelCreateData{
 		Name:     response.Slug,
 		Topic:    response.Name,
-		ParentID: HostResponsesCategID,
+		ParentID: g.HostResponsesCategID,
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("could not create channel #%s: %w", response.Slug, err)
 	}
+	if store != nil {
+		err = store.AddChannel(g.GuildID, &CreatedChannel{
+			ChannelID: channel.ID,
+			Name:      channel.Name,
+			Reason:    "host-response",
+			Created:   time.Now(),
+		})
+		if err != nil {
+			slog.Warn("could not record created channel", "guild", g.Name, "channel", channel.Name, "error", err)
+		}
+	}
+	_, err = s.ChannelMessageSendEmbed(channel.ID, hostResponseEmbed(response))
+	if err != nil {
+		return nil, fmt.Errorf("could not send message to #%s: %w", response.Slug, err)
+	}
+	return channel, nil
+}
+
+// hostResponseEmbed shows the raw host response in the proposed project's
+// channel.
+func hostResponseEmbed(response *hostResponse) *discordgo.MessageEmbed {
 	var embed discordgo.MessageEmbed
 	for _, val := range response.Response {
 		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
@@ -69,9 +330,5 @@ func createProposedProjectChannel(s *discordgo.Session, response *hostResponse)
 			Inline: false,
 		})
 	}
-	_, err = s.ChannelMessageSendEmbed(channel.ID, &embed)
-	if err != nil {
-		return nil, fmt.Errorf("could not send message to #%s: %w", response.Slug, err)
-	}
-	return channel, nil
+	return &embed
 }
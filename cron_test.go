@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// lastMessage returns the content of the newest message in the channel.
+func lastMessage(t *testing.T, f *fakeDiscord, channelID string) string {
+	t.Helper()
+	msgs := f.Messages(channelID)
+	if len(msgs) == 0 {
+		t.Fatal("no messages")
+	}
+	return msgs[len(msgs)-1].Content
+}
+
+// embedTitles returns the titles of the message's embeds.
+func embedTitles(msg *discordgo.Message) []string {
+	var titles []string
+	for _, e := range msg.Embeds {
+		titles = append(titles, e.Title)
+	}
+	return titles
+}
+
+func TestCheckWebsiteCron(t *testing.T) {
+	e := newTestEnv(t)
+	e.OpenStore(t)
+	e.ListProject("listed", day(10))
+	e.WebsiteProject("listed", day(10))
+	e.WebsiteProject("new", day(10))
+	job := &checkJob{Name: "check-website", Checks: []Check{missingProjectsCheck{}}}
+	ctx := context.Background()
+
+	// The new finding pings the tech team.
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err != nil {
+		t.Fatal(err)
+	}
+	msgs := e.Discord.Messages(e.TechTeam.ID)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want report and summary", len(msgs))
+	}
+	report := msgs[0]
+	if titles := embedTitles(report); !strings.HasPrefix(report.Content, "<@&200>") || len(titles) != 1 || titles[0] != "new" {
+		t.Errorf("report = %q with embeds %q, want ping and the new project", report.Content, titles)
+	}
+	summary := msgs[1]
+
+	// Nothing changed, so nothing is posted.
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(e.Discord.Messages(e.TechTeam.ID)); n != 2 {
+		t.Errorf("got %d messages after an unchanged run, want 2", n)
+	}
+
+	// Another finding is reported, the first one is still open.
+	e.WebsiteProject("newer", day(10))
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err != nil {
+		t.Fatal(err)
+	}
+	msgs = e.Discord.Messages(e.TechTeam.ID)
+	if titles := embedTitles(msgs[len(msgs)-1]); len(titles) != 1 || titles[0] != "newer" {
+		t.Errorf("last report has embeds %q, want the newer project", titles)
+	}
+	if !strings.HasPrefix(summary.Content, "Still open from earlier reports (1)") || !strings.Contains(summary.Content, "new") {
+		t.Errorf("summary = %q, want the first finding", summary.Content)
+	}
+
+	// Once fixed, the findings are resolved and the summary edited in place.
+	e.ListProject("new", day(10))
+	e.ListProject("newer", day(10))
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err != nil {
+		t.Fatal(err)
+	}
+	if msg := lastMessage(t, e.Discord, e.TechTeam.ID); !strings.HasPrefix(msg, "Resolved:") {
+		t.Errorf("last message = %q, want resolved findings", msg)
+	}
+	if !strings.HasPrefix(summary.Content, "No previously reported issues") {
+		t.Errorf("summary = %q, want no open findings", summary.Content)
+	}
+}
+
+func TestCheckWebsiteCronFailure(t *testing.T) {
+	e := newTestEnv(t)
+	e.OpenStore(t)
+	e.WebsiteProject("new", day(10))
+	job := &checkJob{Name: "check-website", Checks: []Check{missingProjectsCheck{}}}
+	ctx := context.Background()
+
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err != nil {
+		t.Fatal(err)
+	}
+	// Findings of a failed check are neither resolved nor reported again.
+	e.Discord.Fail("GuildChannels", e.Guild.GuildID, errors.New("discord is down"))
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err == nil {
+		t.Error("expected an error for the failed check")
+	}
+	msg := lastMessage(t, e.Discord, e.TechTeam.ID)
+	if !strings.HasPrefix(msg, "Failed:") || !strings.Contains(msg, "discord is down") {
+		t.Errorf("last message = %q, want only the failure", msg)
+	}
+	open, err := store.OpenFindings(e.Guild.GuildID, findingsJob("missing-projects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 {
+		t.Errorf("got %d open findings, want the previous one to stay open", len(open))
+	}
+}
+
+func TestCheckWebsiteCronSendFailure(t *testing.T) {
+	e := newTestEnv(t)
+	e.OpenStore(t)
+	e.WebsiteProject("new", day(10))
+	job := &checkJob{Name: "check-website", Checks: []Check{missingProjectsCheck{}}}
+	ctx := context.Background()
+
+	// A report that couldn't be posted is reported again in the next run.
+	e.Discord.Fail("ChannelMessageSendComplex", e.TechTeam.ID, errors.New("missing permissions"))
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err == nil {
+		t.Error("expected an error for the failed report")
+	}
+	e.Discord.Fail("ChannelMessageSendComplex", e.TechTeam.ID, nil)
+	if err := checkWebsiteCron(ctx, e.Discord, e.Guild, job); err != nil {
+		t.Fatal(err)
+	}
+	if titles := embedTitles(e.Discord.Messages(e.TechTeam.ID)[0]); len(titles) != 1 || titles[0] != "new" {
+		t.Errorf("report has embeds %q, want the new project", titles)
+	}
+}
+
+func TestCreateProposedProjectChannel(t *testing.T) {
+	e := newTestEnv(t)
+	e.OpenStore(t)
+	e.Guild.HostResponsesCategID = "300"
+	response := &hostResponse{
+		Message:  "New host response",
+		Name:     "Some Piece",
+		Slug:     "some-piece",
+		Response: [][]string{{"Piece", "Some Piece"}, {"Composer", "Someone"}},
+	}
+
+	c, err := createProposedProjectChannel(e.Discord, e.Guild, response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "some-piece" || c.Topic != "Some Piece" || c.ParentID != "300" {
+		t.Errorf("channel = %+v", c)
+	}
+	msgs := e.Discord.Messages(c.ID)
+	if len(msgs) != 1 || len(msgs[0].Embeds) != 1 || len(msgs[0].Embeds[0].Fields) != 2 {
+		t.Fatalf("messages = %+v, want the response as embed", msgs)
+	}
+	created, err := store.Channels(e.Guild.GuildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].ChannelID != c.ID || created[0].Reason != "host-response" {
+		t.Errorf("recorded channels = %+v", created)
+	}
+
+	// Without a store, the channel is created but not recorded.
+	store = nil
+	response.Slug = "other-piece"
+	if c, err := createProposedProjectChannel(e.Discord, e.Guild, response); err != nil || len(e.Discord.Messages(c.ID)) != 1 {
+		t.Errorf("without store: err = %v, want the channel with the response", err)
+	}
+
+	e.Discord.Fail("GuildChannelCreateComplex", e.Guild.GuildID, errors.New("missing permissions"))
+	if _, err := createProposedProjectChannel(e.Discord, e.Guild, response); err == nil {
+		t.Error("expected an error")
+	}
+}
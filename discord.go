@@ -0,0 +1,19 @@
+package main
+
+import "github.com/bwmarrin/discordgo"
+
+// discordSession contains the Discord API calls used by commands, checks and
+// cron jobs. It is implemented by *discordgo.Session and by an in-memory fake
+// in the tests.
+type discordSession interface {
+	GuildChannels(guildID string) ([]*discordgo.Channel, error)
+	GuildChannelCreateComplex(guildID string, data discordgo.GuildChannelCreateData) (*discordgo.Channel, error)
+	ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error)
+	ChannelMessagesPinned(channelID string) ([]*discordgo.Message, error)
+	ChannelMessageSend(channelID string, content string) (*discordgo.Message, error)
+	ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error)
+	ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error)
+	ChannelMessageEditComplex(m *discordgo.MessageEdit) (*discordgo.Message, error)
+}
+
+var _ discordSession = (*discordgo.Session)(nil)
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeDiscord is an in-memory guild implementing discordSession. Messages are
+// stored per channel in the order they were posted.
+type fakeDiscord struct {
+	mu       sync.Mutex
+	guildID  string
+	channels []*discordgo.Channel
+	messages map[string][]*discordgo.Message // by channel ID
+	pins     map[string][]*discordgo.Message // by channel ID
+	errors   map[string]error                // by method and ID, see Fail
+	seq      int64
+}
+
+func newFakeDiscord(guildID string) *fakeDiscord {
+	return &fakeDiscord{
+		guildID:  guildID,
+		messages: make(map[string][]*discordgo.Message),
+		pins:     make(map[string][]*discordgo.Message),
+		errors:   make(map[string]error),
+	}
+}
+
+// snowflake returns a new unique ID containing the timestamp t.
+func (f *fakeDiscord) snowflake(t time.Time) string {
+	f.seq++
+	ms := t.UnixMilli() - 1420070400000 // Discord epoch
+	return strconv.FormatInt(ms<<22|f.seq, 10)
+}
+
+// AddChannel creates a text channel.
+func (f *fakeDiscord) AddChannel(name string) *discordgo.Channel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := &discordgo.Channel{ID: f.snowflake(time.Now()), GuildID: f.guildID, Name: name, Type: discordgo.ChannelTypeGuildText}
+	f.channels = append(f.channels, c)
+	return c
+}
+
+// Channel returns the channel with the given name or nil.
+func (f *fakeDiscord) Channel(name string) *discordgo.Channel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.channels {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Post adds a message as if it had been posted at t.
+func (f *fakeDiscord) Post(channelID, content string, t time.Time) *discordgo.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg := &discordgo.Message{ID: f.snowflake(t), ChannelID: channelID, Content: content, Timestamp: t}
+	f.messages[channelID] = append(f.messages[channelID], msg)
+	return msg
+}
+
+// Pin posts and pins a message.
+func (f *fakeDiscord) Pin(channelID, content string) *discordgo.Message {
+	msg := f.Post(channelID, content, time.Now())
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg.Pinned = true
+	f.pins[channelID] = append(f.pins[channelID], msg)
+	return msg
+}
+
+// Messages returns the messages in the channel in the order they were posted.
+func (f *fakeDiscord) Messages(channelID string) []*discordgo.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*discordgo.Message{}, f.messages[channelID]...)
+}
+
+// Fail makes calls of method for the guild or channel id return err.
+func (f *fakeDiscord) Fail(method, id string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[method+" "+id] = err
+}
+
+// notFound is the error Discord returns for unknown channels.
+func notFound(what string) error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: http.StatusNotFound},
+		Message:  &discordgo.APIErrorMessage{Code: discordgo.ErrCodeUnknownChannel, Message: "Unknown " + what},
+	}
+}
+
+// tooLong is the error Discord returns for messages over the length limit.
+func tooLong() error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: http.StatusBadRequest},
+		Message:  &discordgo.APIErrorMessage{Code: 50035, Message: "Invalid Form Body"},
+	}
+}
+
+// check must be called with f.mu held.
+func (f *fakeDiscord) check(method, id string, channel bool) error {
+	if err := f.errors[method+" "+id]; err != nil {
+		return err
+	}
+	if !channel {
+		if id != f.guildID {
+			return notFound("Guild")
+		}
+		return nil
+	}
+	for _, c := range f.channels {
+		if c.ID == id {
+			return nil
+		}
+	}
+	return notFound("Channel")
+}
+
+func (f *fakeDiscord) GuildChannels(guildID string) ([]*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("GuildChannels", guildID, false); err != nil {
+		return nil, err
+	}
+	return append([]*discordgo.Channel{}, f.channels...), nil
+}
+
+func (f *fakeDiscord) GuildChannelCreateComplex(guildID string, data discordgo.GuildChannelCreateData) (*discordgo.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("GuildChannelCreateComplex", guildID, false); err != nil {
+		return nil, err
+	}
+	c := &discordgo.Channel{
+		ID:       f.snowflake(time.Now()),
+		GuildID:  guildID,
+		Name:     data.Name,
+		Topic:    data.Topic,
+		ParentID: data.ParentID,
+		Type:     data.Type,
+	}
+	f.channels = append(f.channels, c)
+	return c, nil
+}
+
+// ChannelMessages returns up to limit messages, newest first. The paging
+// parameters are not supported.
+func (f *fakeDiscord) ChannelMessages(channelID string, limit int, beforeID, afterID, aroundID string) ([]*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("ChannelMessages", channelID, true); err != nil {
+		return nil, err
+	}
+	if beforeID != "" || afterID != "" || aroundID != "" {
+		return nil, fmt.Errorf("fakeDiscord: paging is not supported")
+	}
+	var res []*discordgo.Message
+	msgs := f.messages[channelID]
+	for i := len(msgs) - 1; i >= 0 && len(res) < limit; i-- {
+		res = append(res, msgs[i])
+	}
+	return res, nil
+}
+
+func (f *fakeDiscord) ChannelMessagesPinned(channelID string) ([]*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("ChannelMessagesPinned", channelID, true); err != nil {
+		return nil, err
+	}
+	return append([]*discordgo.Message{}, f.pins[channelID]...), nil
+}
+
+func (f *fakeDiscord) ChannelMessageSend(channelID string, content string) (*discordgo.Message, error) {
+	return f.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: content})
+}
+
+func (f *fakeDiscord) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("ChannelMessageSendComplex", channelID, true); err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(data.Content) > messageLimit {
+		return nil, tooLong()
+	}
+	now := time.Now()
+	msg := &discordgo.Message{
+		ID:         f.snowflake(now),
+		ChannelID:  channelID,
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Timestamp:  now,
+	}
+	if data.Embed != nil {
+		msg.Embeds = append(msg.Embeds, data.Embed)
+	}
+	for _, file := range data.Files {
+		content, err := io.ReadAll(file.Reader)
+		if err != nil {
+			return nil, err
+		}
+		msg.Attachments = append(msg.Attachments, &discordgo.MessageAttachment{Filename: file.Name, Size: len(content)})
+	}
+	f.messages[channelID] = append(f.messages[channelID], msg)
+	return msg, nil
+}
+
+func (f *fakeDiscord) ChannelMessageSendEmbed(channelID string, embed *discordgo.MessageEmbed) (*discordgo.Message, error) {
+	return f.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}})
+}
+
+func (f *fakeDiscord) ChannelMessageEditComplex(m *discordgo.MessageEdit) (*discordgo.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.check("ChannelMessageEditComplex", m.Channel, true); err != nil {
+		return nil, err
+	}
+	if m.Content != nil && utf8.RuneCountInString(*m.Content) > messageLimit {
+		return nil, tooLong()
+	}
+	for _, msg := range f.messages[m.Channel] {
+		if msg.ID != m.ID {
+			continue
+		}
+		if m.Content != nil {
+			msg.Content = *m.Content
+		}
+		if m.Embeds != nil {
+			msg.Embeds = m.Embeds
+		}
+		if m.Components != nil {
+			msg.Components = m.Components
+		}
+		return msg, nil
+	}
+	return nil, notFound("Message")
+}
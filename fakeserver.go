@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeData is the content served by the fake server. It is read from a JSON
+// file.
+type fakeData struct {
+	Projects  []fakeProject          `json:"projects"`  // projects on the homepage
+	Releases  []string               `json:"releases"`  // YouTube video IDs on the releases page
+	Playlists map[string][]fakeVideo `json:"playlists"` // videos by playlist ID
+
+	// Sheets contains the cells by spreadsheet ID and sheet name, starting
+	// at A1.
+	Sheets map[string]map[string][][]interface{} `json:"sheets"`
+}
+
+type fakeProject struct {
+	ID    string   `json:"id"`    // URL slug
+	Name  string   `json:"name"`  // title on the homepage
+	Due   string   `json:"due"`   // deadline, e.g. "January 2"
+	Links []string `json:"links"` // links on the project page
+}
+
+type fakeVideo struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// fakeServer serves a stand-in for the UVE website and the YouTube
+// PlaylistItems and Sheets Values APIs. Sheet updates are only kept in
+// memory.
+type fakeServer struct {
+	mu   sync.Mutex
+	data *fakeData
+}
+
+func loadFakeData(path string) (*fakeData, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var data fakeData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return &data, nil
+}
+
+// runFakeServer serves the data from path on addr until ctx is done.
+func runFakeServer(ctx context.Context, path, addr string) error {
+	data, err := loadFakeData(path)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Addr: addr, Handler: &fakeServer{data: data}, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	slog.Info("serving fake website and Google APIs", "addr", addr, "data", path)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := r.URL.Path
+	switch {
+	case path == "/" || path == "":
+		f.serveHome(w)
+	case strings.HasPrefix(path, "/projects/"):
+		f.serveProject(w, r, strings.TrimPrefix(path, "/projects/"))
+	case path == "/released-performances":
+		f.serveReleases(w)
+	case path == "/youtube/v3/playlistItems":
+		f.servePlaylistItems(w, r)
+	case strings.HasPrefix(path, "/v4/spreadsheets/"):
+		f.serveValues(w, r, strings.TrimPrefix(path, "/v4/spreadsheets/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fakePage writes an HTML page with the structure of the website. The
+// scraper reads links from the second section of the main content.
+func fakePage(w http.ResponseWriter, title string, sections ...string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n<html><head><title>%s</title></head><body>\n<div role=\"main\">\n", html.EscapeString(title))
+	for _, s := range sections {
+		fmt.Fprintf(w, "<section>\n%s</section>\n", s)
+	}
+	fmt.Fprint(w, "</div>\n</body></html>\n")
+}
+
+func (f *fakeServer) serveHome(w http.ResponseWriter) {
+	var links strings.Builder
+	for _, p := range f.data.Projects {
+		fmt.Fprintf(&links, "<p><a href=\"/projects/%s\">Due %s - %s</a></p>\n", html.EscapeString(p.ID), html.EscapeString(p.Due), html.EscapeString(p.Name))
+	}
+	fakePage(w, "Current Projects", links.String())
+}
+
+func (f *fakeServer) serveProject(w http.ResponseWriter, r *http.Request, id string) {
+	for _, p := range f.data.Projects {
+		if p.ID != id {
+			continue
+		}
+		var links strings.Builder
+		for _, l := range p.Links {
+			fmt.Fprintf(&links, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(l), html.EscapeString(l))
+		}
+		fakePage(w, p.Name, "<h1>"+html.EscapeString(p.Name)+"</h1>\n", links.String())
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (f *fakeServer) serveReleases(w http.ResponseWriter) {
+	var links strings.Builder
+	for _, id := range f.data.Releases {
+		fmt.Fprintf(&links, "<p><a href=\"https://www.youtube.com/watch?v=%s\">%s</a></p>\n", html.EscapeString(id), html.EscapeString(id))
+	}
+	fakePage(w, "Released Performances", links.String())
+}
+
+// fakeAPIError writes an error in the format of Google APIs.
+func fakeAPIError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": msg},
+	})
+}
+
+func fakeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// servePlaylistItems implements playlistItems.list with paging.
+func (f *fakeServer) servePlaylistItems(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	videos, ok := f.data.Playlists[q.Get("playlistId")]
+	if !ok {
+		fakeAPIError(w, http.StatusNotFound, "The playlist identified with the request's playlistId parameter cannot be found.")
+		return
+	}
+	pageSize := 5
+	if n, err := strconv.Atoi(q.Get("maxResults")); err == nil && n > 0 {
+		pageSize = n
+	}
+	start := 0
+	if token := q.Get("pageToken"); token != "" {
+		var err error
+		if start, err = strconv.Atoi(token); err != nil || start < 0 || start > len(videos) {
+			fakeAPIError(w, http.StatusBadRequest, "The request specifies an invalid page token.")
+			return
+		}
+	}
+	end := start + pageSize
+	if end > len(videos) {
+		end = len(videos)
+	}
+	var items []map[string]interface{}
+	for i, v := range videos[start:end] {
+		items = append(items, map[string]interface{}{
+			"kind": "youtube#playlistItem",
+			"snippet": map[string]interface{}{
+				"title":      v.Title,
+				"playlistId": q.Get("playlistId"),
+				"position":   start + i,
+				"resourceId": map[string]interface{}{"kind": "youtube#video", "videoId": v.ID},
+			},
+			"contentDetails": map[string]interface{}{"videoId": v.ID},
+		})
+	}
+	res := map[string]interface{}{
+		"kind":     "youtube#playlistItemListResponse",
+		"items":    items,
+		"pageInfo": map[string]interface{}{"totalResults": len(videos), "resultsPerPage": pageSize},
+	}
+	if end < len(videos) {
+		res["nextPageToken"] = strconv.Itoa(end)
+	}
+	fakeJSON(w, res)
+}
+
+// serveValues implements spreadsheets.values.get and update for ranges in
+// A1 notation.
+func (f *fakeServer) serveValues(w http.ResponseWriter, r *http.Request, path string) {
+	sheetID, rng, ok := strings.Cut(path, "/values/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	sheets, ok := f.data.Sheets[sheetID]
+	if !ok {
+		fakeAPIError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	a1, err := parseA1(rng)
+	if err != nil {
+		fakeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cells, ok := sheets[a1.Sheet]
+	if !ok {
+		fakeAPIError(w, http.StatusBadRequest, "Unable to parse range: "+rng)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		values := a1.Get(cells)
+		if r.URL.Query().Get("valueRenderOption") != "UNFORMATTED_VALUE" {
+			formatValues(values)
+		}
+		res := map[string]interface{}{"range": rng, "majorDimension": "ROWS"}
+		if len(values) > 0 {
+			res["values"] = values
+		}
+		fakeJSON(w, res)
+	case http.MethodPut:
+		var body struct {
+			Values [][]interface{} `json:"values"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			fakeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sheets[a1.Sheet] = a1.Set(cells, body.Values)
+		fakeJSON(w, map[string]interface{}{
+			"spreadsheetId": sheetID,
+			"updatedRange":  rng,
+			"updatedRows":   len(body.Values),
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// a1Range is a range like "Sheet!B3:B3" or "Sheet!A5:M". Rows and columns
+// start at 0, an end of -1 is unbounded.
+type a1Range struct {
+	Sheet          string
+	Row, Col       int
+	EndRow, EndCol int
+}
+
+func parseA1(s string) (a1Range, error) {
+	var r a1Range
+	i := strings.LastIndex(s, "!")
+	if i < 0 {
+		return r, fmt.Errorf("Unable to parse range: %s", s)
+	}
+	r.Sheet = strings.Trim(s[:i], "'")
+	start, end, _ := strings.Cut(s[i+1:], ":")
+	var err error
+	if r.Row, r.Col, err = parseA1Cell(start); err != nil || r.Row < 0 || r.Col < 0 {
+		return r, fmt.Errorf("Unable to parse range: %s", s)
+	}
+	r.EndRow, r.EndCol = r.Row, r.Col
+	if end != "" {
+		if r.EndRow, r.EndCol, err = parseA1Cell(end); err != nil {
+			return r, fmt.Errorf("Unable to parse range: %s", s)
+		}
+	}
+	return r, nil
+}
+
+// parseA1Cell parses a cell like "B3". Missing parts are returned as -1.
+func parseA1Cell(s string) (row, col int, err error) {
+	letters := strings.TrimRight(s, "0123456789")
+	col = -1
+	for _, c := range strings.ToUpper(letters) {
+		if c < 'A' || c > 'Z' {
+			return 0, 0, fmt.Errorf("invalid cell %q", s)
+		}
+		col = (col+1)*26 + int(c-'A')
+	}
+	row = -1
+	if digits := s[len(letters):]; digits != "" {
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid cell %q", s)
+		}
+		row = n - 1
+	}
+	return row, col, nil
+}
+
+// Get returns the cells in the range. Like the Sheets API, trailing empty
+// rows are omitted.
+func (r a1Range) Get(cells [][]interface{}) [][]interface{} {
+	var res [][]interface{}
+	for i := r.Row; i < len(cells) && (r.EndRow < 0 || i <= r.EndRow); i++ {
+		var row []interface{}
+		for j := r.Col; j < len(cells[i]) && (r.EndCol < 0 || j <= r.EndCol); j++ {
+			row = append(row, cells[i][j])
+		}
+		res = append(res, row)
+	}
+	for len(res) > 0 && len(res[len(res)-1]) == 0 {
+		res = res[:len(res)-1]
+	}
+	return res
+}
+
+// Set writes values starting at the top left of the range and returns the
+// updated cells.
+func (r a1Range) Set(cells [][]interface{}, values [][]interface{}) [][]interface{} {
+	for i, row := range values {
+		for len(cells) <= r.Row+i {
+			cells = append(cells, nil)
+		}
+		for j, v := range row {
+			for len(cells[r.Row+i]) <= r.Col+j {
+				cells[r.Row+i] = append(cells[r.Row+i], "")
+			}
+			cells[r.Row+i][r.Col+j] = v
+		}
+	}
+	return cells
+}
+
+// formatValues converts all values to strings as the Sheets API does by
+// default.
+func formatValues(values [][]interface{}) {
+	for _, row := range values {
+		for j, v := range row {
+			switch v := v.(type) {
+			case float64:
+				row[j] = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				row[j] = strings.ToUpper(strconv.FormatBool(v))
+			case nil:
+				row[j] = ""
+			default:
+				row[j] = fmt.Sprint(v)
+			}
+		}
+	}
+}
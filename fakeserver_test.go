@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+	"google.golang.org/api/youtube/v3"
+)
+
+func TestFakeServer(t *testing.T) {
+	data, err := loadFakeData("testdata/fake-server.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&fakeServer{data: data})
+	defer srv.Close()
+
+	e := newTestEnv(t)
+	e.Guild.WebsiteURL = srv.URL
+	e.Guild.WebsiteReleasesURL = srv.URL + "/released-performances"
+	e.Guild.PlaylistID = "PLfake"
+	e.Guild.HostResponsesSheetID = "fake-sheet"
+	ctx := context.Background()
+	yt, err = youtube.NewService(ctx, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSheets := sheetsService
+	defer func() { sheetsService = oldSheets }()
+	sheetsService, err = sheets.NewService(ctx, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	projects, err := getWebsiteProjects(ctx, e.Guild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fetchWebsiteProjectLinks(ctx, e.Guild, projects); err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 {
+		t.Fatalf("got %d projects, want 2", len(projects))
+	}
+	for _, p := range projects {
+		if p.ID == "elgar-nimrod" && !reflect.DeepEqual(p.URLs, []string{"https://drive.google.com/drive/folders/nimrod-parts", "https://youtu.be/nimrodclick"}) {
+			t.Errorf("URLs of %s = %q", p.ID, p.URLs)
+		}
+	}
+
+	// The playlist is paged by the fake server.
+	data.Playlists["PLfake"] = append(data.Playlists["PLfake"], make([]fakeVideo, 60)...)
+	videos, err := getYoutubeVideos(ctx, yt, e.Guild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(videos) != 63 || videos[2].ContentDetails.VideoId != "OPf0YbXqDm0" {
+		t.Errorf("got %d videos", len(videos))
+	}
+	data.Playlists["PLfake"] = data.Playlists["PLfake"][:3]
+
+	findings, failures := e.runTestChecks(t, "releases")
+	assertNoFailures(t, failures)
+	assertFindings(t, findings, "release-missing-on-website OPf0YbXqDm0")
+
+	responses, err := checkHostResponses(ctx, sheetsService, e.Guild, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 || responses[0].Slug != "pachelbel-canon-in-d" {
+		t.Errorf("responses = %+v", responses)
+	}
+	// The last row id was advanced.
+	responses, err = checkHostResponses(ctx, sheetsService, e.Guild, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 0 {
+		t.Errorf("got %d responses on the second run, want 0", len(responses))
+	}
+}
+
+func TestParseA1(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want a1Range
+	}{
+		{"UVE Bot!B3:B3", a1Range{Sheet: "UVE Bot", Row: 2, Col: 1, EndRow: 2, EndCol: 1}},
+		{"'Form Responses 1'!A5:M", a1Range{Sheet: "Form Responses 1", Row: 4, Col: 0, EndRow: -1, EndCol: 12}},
+		{"Sheet!AA10", a1Range{Sheet: "Sheet", Row: 9, Col: 26, EndRow: 9, EndCol: 26}},
+	} {
+		got, err := parseA1(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("parseA1(%q) = %+v, %v, want %+v", tc.in, got, err, tc.want)
+		}
+	}
+	if _, err := parseA1("B3"); err == nil {
+		t.Error("expected an error without sheet")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// parallel calls fn for every index in [0, n) using at most workers
+// goroutines and waits until all calls returned. Callers store results by
+// index to keep their order deterministic.
+func parallel(workers, n int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// hostLimiter spaces out requests to the same host.
+type hostLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time // earliest time of the next request by host
+}
+
+// hostLimits limits all website requests to cfg.RequestsPerHost.
+var hostLimits = &hostLimiter{next: make(map[string]time.Time)}
+
+// Wait blocks until a request to host may be made at the given rate in
+// requests per second or until ctx is done.
+func (l *hostLimiter) Wait(ctx context.Context, host string, rate float64) error {
+	if rate <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(interval)
+	l.mu.Unlock()
+	return sleep(ctx, at.Sub(now))
+}
+
+// webClient is used for website requests. It is replaced to record or
+// replay responses.
+var webClient = http.DefaultClient
+
+// httpGet is http.Get limited by hostLimits and cached in webCache.
+// Responses with a status other than 200 are returned as *statusError.
+func httpGet(ctx context.Context, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var cached *cacheEntry
+	if webCache != nil {
+		cached = webCache.Load(rawURL)
+		if cached != nil && cached.Fresh(time.Now()) {
+			return cached.Response(), nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		cached.Conditional(req)
+	}
+	if err := hostLimits.Wait(ctx, u.Host, cfg.RequestsPerHost); err != nil {
+		return nil, err
+	}
+	res, err := webClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		res.Body.Close()
+		cached.Update(res)
+		if err := webCache.Save(cached); err != nil {
+			slog.Warn("could not update cache", "url", rawURL, "error", err)
+		}
+		return cached.Response(), nil
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, &statusError{
+			Code:       res.StatusCode,
+			URL:        rawURL,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+	if webCache == nil || parseCacheControl(res.Header.Get("Cache-Control")).NoStore {
+		return res, nil
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{URL: rawURL, Body: body}
+	entry.Update(res)
+	if err := webCache.Save(entry); err != nil {
+		slog.Warn("could not cache response", "url", rawURL, "error", err)
+	}
+	return entry.Response(), nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// FindingKind classifies what a check found.
+type FindingKind string
+
+const (
+	KindWrongDeadline            FindingKind = "wrong-deadline"              // deadlines on website and in #current-projects differ
+	KindDeadlinePassed           FindingKind = "deadline-passed"             // project still listed after its deadline
+	KindURLNotPinned             FindingKind = "url-not-pinned"              // URL from the project page is not pinned in the channel
+	KindNotInCurrentProjects     FindingKind = "not-in-current-projects"     // project on website but not in #current-projects
+	KindMissingOnWebsite         FindingKind = "missing-on-website"          // project in #current-projects but not on website
+	KindReleaseMissingOnWebsite  FindingKind = "release-missing-on-website"  // video in playlist but not on releases page
+	KindReleaseMissingInPlaylist FindingKind = "release-missing-in-playlist" // video on releases page but not in playlist
+)
+
+// Severity is how urgent a finding is.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalJSON encodes the severity by name.
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes a severity name.
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for i, n := range severityNames {
+		if n == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", name)
+}
+
+// Finding is a single discrepancy found by a check.
+type Finding struct {
+	Check    string      `json:"check"`   // name of the check, e.g. "deadline"
+	Subject  string      `json:"subject"` // project or video ID
+	Name     string      `json:"name"`    // display name of the subject
+	Kind     FindingKind `json:"kind"`
+	Severity Severity    `json:"severity"`
+	Details  string      `json:"details"` // human-readable description
+	Links    []string    `json:"links,omitempty"`
+	Project  *ProjectRef `json:"project,omitempty"` // for findings about a project
+}
+
+// ProjectRef refers to where a project is listed so that reports can link
+// there. Fields are empty if the project isn't listed in a place.
+type ProjectRef struct {
+	ChannelID       string    `json:"channel_id,omitempty"`  // project channel
+	MessageURL      string    `json:"message_url,omitempty"` // entry in #current-projects
+	WebsiteURL      string    `json:"website_url,omitempty"` // project page
+	Deadline        time.Time `json:"deadline"`              // in #current-projects
+	WebsiteDeadline time.Time `json:"website_deadline"`
+}
+
+// Key identifies the finding across runs. Findings with the same key but
+// different details are the same issue that changed. The check name is not
+// part of the key since kinds are unique between checks, so that splitting or
+// renaming checks keeps the IDs stable.
+func (f *Finding) Key() string {
+	key := string(f.Kind) + "/" + f.Subject
+	if len(f.Links) > 0 {
+		key += "/" + strings.Join(f.Links, " ")
+	}
+	return key
+}
+
+// ID is a short identifier derived from Key that users can refer to, e.g.
+// for snoozing.
+func (f *Finding) ID() string {
+	sum := sha1.Sum([]byte(f.Key()))
+	return hex.EncodeToString(sum[:4])
+}
+
+// diffFindings compares the current findings with the previously open ones.
+// Added contains new and changed findings, open those that were reported
+// before and resolved those that disappeared.
+func diffFindings(prev map[string]Finding, cur []Finding) (added, open, resolved []Finding) {
+	seen := make(map[string]bool)
+	for _, f := range cur {
+		key := f.Key()
+		seen[key] = true
+		if p, ok := prev[key]; ok && p.Details == f.Details {
+			open = append(open, f)
+		} else {
+			added = append(added, f)
+		}
+	}
+	for key, f := range prev {
+		if !seen[key] {
+			resolved = append(resolved, f)
+		}
+	}
+	sortFindings(resolved)
+	return added, open, resolved
+}
+
+// sortFindings orders findings by check, subject and kind so that reports
+// are stable between runs.
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		if a.Subject != b.Subject {
+			return a.Subject < b.Subject
+		}
+		return a.Kind < b.Kind
+	})
+}
+
+// renderFindingsMarkdown renders findings as Markdown list for Discord.
+func renderFindingsMarkdown(findings []Finding) string {
+	var msg strings.Builder
+	for _, f := range findings {
+		fmt.Fprintf(&msg, "- %s: %s `%s`\n", f.Name, f.Details, f.ID())
+	}
+	return msg.String()
+}
+
+// renderFindingsCLI renders findings as plain text for the command line.
+func renderFindingsCLI(findings []Finding) string {
+	var msg strings.Builder
+	for _, f := range findings {
+		fmt.Fprintf(&msg, "%s %-7s %s %s: %s\n", f.ID(), f.Severity, f.Kind, f.Name, f.Details)
+	}
+	return msg.String()
+}
+
+// Embed colors by severity.
+var severityColors = []int{0x3498db, 0xf1c40f, 0xe74c3c}
+
+// Discord's limits for embeds.
+const (
+	maxEmbedFields     = 25   // fields per embed
+	maxEmbedFieldValue = 1024 // characters per field value
+	maxEmbeds          = 10   // embeds per message
+	maxEmbedsSize      = 6000 // characters in all embeds of a message
+)
+
+// discordDate formats a deadline as Discord timestamp so that it is shown in
+// the reader's time zone. Deadlines are dates at midnight UTC, noon is used
+// so that the date is the same in all common time zones.
+func discordDate(t time.Time, style string) string {
+	return fmt.Sprintf("<t:%d:%s>", t.Add(12*time.Hour).Unix(), style)
+}
+
+// embedDetails describes the finding for an embed, with Discord timestamps
+// instead of plain dates.
+func embedDetails(f *Finding) string {
+	p := f.Project
+	switch {
+	case p != nil && f.Kind == KindWrongDeadline:
+		return fmt.Sprintf("wrong deadline (website: %s, #current-projects: %s)", discordDate(p.WebsiteDeadline, "D"), discordDate(p.Deadline, "D"))
+	case p != nil && f.Kind == KindDeadlinePassed:
+		return fmt.Sprintf("deadline %s has passed", discordDate(p.Deadline, "D"))
+	}
+	return f.Details
+}
+
+// projectEmbed starts the embed for the subject of f with links to where the
+// project is listed and its deadline.
+func projectEmbed(f *Finding) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: f.Name}
+	p := f.Project
+	if p == nil {
+		return embed
+	}
+	embed.URL = p.WebsiteURL
+	var links []string
+	if p.ChannelID != "" {
+		links = append(links, "<#"+p.ChannelID+">")
+	}
+	if p.MessageURL != "" {
+		links = append(links, "[#current-projects]("+p.MessageURL+")")
+	}
+	if p.WebsiteURL != "" {
+		links = append(links, "[website]("+p.WebsiteURL+")")
+	}
+	embed.Description = strings.Join(links, " · ")
+	deadline := p.Deadline
+	if deadline.IsZero() {
+		deadline = p.WebsiteDeadline
+	}
+	if !deadline.IsZero() {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Deadline",
+			Value:  fmt.Sprintf("%s (%s)", discordDate(deadline, "D"), discordDate(deadline, "R")),
+			Inline: true,
+		})
+	}
+	return embed
+}
+
+// embedSize returns the number of characters that count towards
+// maxEmbedsSize.
+func embedSize(e *discordgo.MessageEmbed) int {
+	n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+	for _, f := range e.Fields {
+		n += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+	}
+	if e.Footer != nil {
+		n += utf8.RuneCountInString(e.Footer.Text)
+	}
+	return n
+}
+
+// renderFindingsEmbeds renders findings as one embed per project or video,
+// colored by the highest severity and with the most severe first. Projects
+// that don't fit into one message are listed in a last embed. Complete is
+// false if any findings or details were left out.
+func renderFindingsEmbeds(findings []Finding) (embeds []*discordgo.MessageEmbed, complete bool) {
+	complete = true
+	bySubject := make(map[string]*discordgo.MessageEmbed)
+	maxSeverity := make(map[*discordgo.MessageEmbed]Severity)
+	for _, f := range findings {
+		embed, ok := bySubject[f.Subject]
+		if !ok {
+			embed = projectEmbed(&f)
+			bySubject[f.Subject] = embed
+			embeds = append(embeds, embed)
+		}
+		if f.Severity > maxSeverity[embed] {
+			maxSeverity[embed] = f.Severity
+		}
+		if len(embed.Fields) == maxEmbedFields {
+			embed.Footer = &discordgo.MessageEmbedFooter{Text: "more findings omitted"}
+			complete = false
+			continue
+		}
+		details := embedDetails(&f)
+		if utf8.RuneCountInString(details) > maxEmbedFieldValue {
+			complete = false
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("%s (%s, `%s`)", f.Check, f.Kind, f.ID()),
+			Value: truncate(details, maxEmbedFieldValue),
+		})
+	}
+	for _, embed := range embeds {
+		embed.Color = severityColors[maxSeverity[embed]]
+	}
+	sort.SliceStable(embeds, func(i, j int) bool {
+		return maxSeverity[embeds[i]] > maxSeverity[embeds[j]]
+	})
+
+	size := 0
+	for _, embed := range embeds {
+		size += embedSize(embed)
+	}
+	if len(embeds) <= maxEmbeds && size <= maxEmbedsSize {
+		return embeds, complete
+	}
+	// Keep room for the list of the remaining projects.
+	n := 0
+	size = 0
+	for n < maxEmbeds-1 && size+embedSize(embeds[n]) <= maxEmbedsSize-1000 {
+		size += embedSize(embeds[n])
+		n++
+	}
+	rest := embeds[n:]
+	more := &discordgo.MessageEmbed{Title: fmt.Sprintf("%d more", len(rest))}
+	var names []string
+	for _, e := range rest {
+		names = append(names, e.Title)
+		if maxSeverity[e] > maxSeverity[more] {
+			maxSeverity[more] = maxSeverity[e]
+		}
+	}
+	more.Description = truncate(strings.Join(names, ", "), 900)
+	more.Color = severityColors[maxSeverity[more]]
+	return append(embeds[:n:n], more), false
+}
+
+// findingsMessage returns a message with the findings as embeds and menus to
+// snooze them. If the embeds or menus can't show all findings, the full list
+// is attached as Markdown so that no details or IDs are lost.
+func findingsMessage(content string, findings []Finding) *discordgo.MessageSend {
+	embeds, complete := renderFindingsEmbeds(findings)
+	msg := &discordgo.MessageSend{
+		Content:    content,
+		Embeds:     embeds,
+		Components: snoozeComponents(findings),
+	}
+	if !complete || len(findings) > maxSelectOptions {
+		msg.Content = strings.TrimRight(content, "\n") + "\nNot all findings fit, the full list with IDs is attached."
+		msg.Files = []*discordgo.File{{
+			Name:        "findings.md",
+			ContentType: "text/markdown; charset=utf-8",
+			Reader:      strings.NewReader(renderFindingsMarkdown(findings)),
+		}}
+	}
+	return msg
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRenderFindingsEmbeds(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.ListProject("moved", day(10))
+	e.WebsiteProject("moved", day(13), "https://example.com/sheet")
+	e.WebsiteProject("unlisted", day(20))
+
+	findings, failures := e.runTestChecks(t, "deadline", "pinned-urls", "missing-projects")
+	assertNoFailures(t, failures)
+	sortFindings(findings)
+	embeds, complete := renderFindingsEmbeds(findings)
+	if len(embeds) != 2 || !complete {
+		t.Fatalf("got %d embeds (complete: %v), want one per project", len(embeds), complete)
+	}
+	if msg := findingsMessage("3 findings:", findings); len(msg.Files) != 0 {
+		t.Error("findings that fit shouldn't be attached")
+	}
+
+	moved := embeds[0]
+	if moved.Title != "moved" || len(moved.Fields) != 3 {
+		t.Fatalf("embed = %+v, want the moved project with deadline and two findings", moved)
+	}
+	if moved.Color != severityColors[SeverityWarning] {
+		t.Errorf("color = %#x, want the warning color", moved.Color)
+	}
+	website := e.Guild.WebsiteURL + "/projects/moved"
+	if moved.URL != website {
+		t.Errorf("URL = %q, want %q", moved.URL, website)
+	}
+	for _, link := range []string{"<#" + c.ID + ">", "https://discord.com/channels/100/" + e.CurrentProjects.ID + "/", "(" + website + ")"} {
+		if !strings.Contains(moved.Description, link) {
+			t.Errorf("description = %q, want link %q", moved.Description, link)
+		}
+	}
+	deadline := fmt.Sprintf("<t:%d:D>", day(10).Unix()+12*60*60)
+	if !strings.HasPrefix(moved.Fields[0].Value, deadline) {
+		t.Errorf("deadline = %q, want timestamp %s", moved.Fields[0].Value, deadline)
+	}
+	var details []string
+	for _, f := range moved.Fields[1:] {
+		details = append(details, f.Value)
+	}
+	if !strings.Contains(strings.Join(details, "\n"), "#current-projects: "+deadline) {
+		t.Errorf("details = %q, want deadlines as timestamps", details)
+	}
+
+	// Only listed on the website, so there is no channel to link to.
+	unlisted := embeds[1]
+	if unlisted.Title != "unlisted" || strings.Contains(unlisted.Description, "<#") || !strings.Contains(unlisted.Description, "website") {
+		t.Errorf("embed = %+v, want only the website link", unlisted)
+	}
+}
+
+func TestRenderFindingsEmbedsOverflow(t *testing.T) {
+	var findings []Finding
+	for i := 0; i < 30; i++ {
+		findings = append(findings, Finding{
+			Check:    "missing-projects",
+			Subject:  fmt.Sprintf("project-%02d", i),
+			Name:     fmt.Sprintf("project-%02d", i),
+			Kind:     KindMissingOnWebsite,
+			Severity: SeverityInfo,
+			Details:  strings.Repeat("x", 500),
+		})
+	}
+	findings[29].Severity = SeverityError
+
+	embeds, complete := renderFindingsEmbeds(findings)
+	if complete {
+		t.Error("embeds should be incomplete")
+	}
+	if len(embeds) > maxEmbeds {
+		t.Fatalf("got %d embeds, want at most %d", len(embeds), maxEmbeds)
+	}
+	size := 0
+	for _, embed := range embeds {
+		size += embedSize(embed)
+	}
+	if size > maxEmbedsSize {
+		t.Errorf("embeds have %d characters, want at most %d", size, maxEmbedsSize)
+	}
+	if embeds[0].Title != "project-29" {
+		t.Errorf("first embed = %q, want the most severe project", embeds[0].Title)
+	}
+	more := embeds[len(embeds)-1]
+	if !strings.HasSuffix(more.Title, " more") || !strings.Contains(more.Description, "project-28") {
+		t.Errorf("last embed = %+v, want the remaining projects", more)
+	}
+
+	// Every finding reaches the user with its details and ID.
+	msg := findingsMessage("30 findings:", findings)
+	if len(msg.Files) != 1 {
+		t.Fatalf("got %d files, want the findings attached", len(msg.Files))
+	}
+	if !strings.Contains(msg.Content, "attached") {
+		t.Errorf("content = %q, want a note about the attachment", msg.Content)
+	}
+	attached, err := io.ReadAll(msg.Files[0].Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		if !strings.Contains(string(attached), fmt.Sprintf("- %s: %s `%s`", f.Name, f.Details, f.ID())) {
+			t.Errorf("finding %s is missing in the attachment", f.ID())
+		}
+	}
+}
+
+func TestFindingsMessageSnoozeLimit(t *testing.T) {
+	// Small findings fit into the embeds, but not into the snooze menus.
+	var findings []Finding
+	for i := 0; i < maxSelectOptions+1; i++ {
+		findings = append(findings, Finding{Check: "pinned-urls", Subject: "p", Name: "p", Kind: KindURLNotPinned, Details: "not pinned", Links: []string{fmt.Sprint(i)}})
+	}
+	msg := findingsMessage("", findings)
+	if len(msg.Files) != 1 {
+		t.Errorf("got %d files, want the findings the menus can't list attached", len(msg.Files))
+	}
+}
+
+func TestFindingsSummaryHidden(t *testing.T) {
+	e := newTestEnv(t)
+	e.OpenStore(t)
+	e.WebsiteProject("snoozed", day(20))
+	e.WebsiteProject("unlisted", day(20))
+
+	findings, failures := e.runTestChecks(t, "missing-projects")
+	assertNoFailures(t, failures)
+	for _, f := range findings {
+		if f.Subject == "snoozed" {
+			if err := snoozeFindings(e.Guild, []string{f.ID()}, 7, "1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	res := findingsResult(e.Guild, findings, nil)
+	if len(res.Findings) != 1 || res.Hidden != 1 {
+		t.Fatalf("got %d findings and %d hidden, want one of each", len(res.Findings), res.Hidden)
+	}
+	want := "1 finding:\n(1 snoozed or acknowledged findings not shown)\n"
+	if got := findingsSummary(res); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpCache stores website responses on disk so that unchanged pages are only
+// revalidated with a conditional request instead of downloaded again.
+type httpCache struct {
+	dir string
+}
+
+// webCache is the cache used by httpGet, nil if caching is disabled.
+var webCache *httpCache
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	CacheControl string    `json:"cache_control,omitempty"`
+	Stored       time.Time `json:"stored"` // time of the last download or revalidation
+	Body         []byte    `json:"body"`
+}
+
+func (c *httpCache) path(url string) string {
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Load returns the cached response for url, or nil if there is none.
+func (c *httpCache) Load(url string) *cacheEntry {
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return nil
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url {
+		return nil
+	}
+	return &e
+}
+
+// Save stores a response. Writes are atomic so that concurrent fetches of the
+// same URL don't corrupt the entry.
+func (c *httpCache) Save(e *cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path(e.URL))
+}
+
+// cacheDirectives are the parts of a Cache-Control header the cache honors.
+type cacheDirectives struct {
+	MaxAge  time.Duration
+	NoCache bool // always revalidate
+	NoStore bool // don't cache at all
+}
+
+func parseCacheControl(header string) cacheDirectives {
+	var d cacheDirectives
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			d.NoCache = true
+		case "no-store":
+			d.NoStore = true
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				d.MaxAge = time.Duration(secs) * time.Second
+			}
+		}
+	}
+	return d
+}
+
+// Fresh reports whether the entry may be used without revalidation. Without
+// max-age, responses are always revalidated.
+func (e *cacheEntry) Fresh(now time.Time) bool {
+	d := parseCacheControl(e.CacheControl)
+	return !d.NoCache && d.MaxAge > 0 && now.Before(e.Stored.Add(d.MaxAge))
+}
+
+// Conditional adds the validators of the entry to a request.
+func (e *cacheEntry) Conditional(req *http.Request) {
+	if e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// Update takes the caching headers from a response. Headers missing in a 304
+// response keep their previous values.
+func (e *cacheEntry) Update(res *http.Response) {
+	if v := res.Header.Get("ETag"); v != "" {
+		e.ETag = v
+	}
+	if v := res.Header.Get("Last-Modified"); v != "" {
+		e.LastModified = v
+	}
+	if v := res.Header.Get("Cache-Control"); v != "" {
+		e.CacheControl = v
+	}
+	e.Stored = time.Now()
+}
+
+// Response returns the cached body as a successful response.
+func (e *cacheEntry) Response() *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader(e.Body)),
+	}
+}
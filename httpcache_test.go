@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheTestSite serves a page with configurable caching headers and records
+// the requests it gets.
+type cacheTestSite struct {
+	mu           sync.Mutex
+	body         string
+	etag         string
+	lastModified string
+	cacheControl string
+	requests     []http.Header
+}
+
+func (s *cacheTestSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Header.Clone())
+	if s.cacheControl != "" {
+		w.Header().Set("Cache-Control", s.cacheControl)
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	if s.lastModified != "" {
+		w.Header().Set("Last-Modified", s.lastModified)
+	}
+	// If-Modified-Since is ignored if If-None-Match is sent.
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if inm == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && ims == s.lastModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	io.WriteString(w, s.body)
+}
+
+// Requests returns the number of requests so far.
+func (s *cacheTestSite) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+// LastRequest returns the headers of the last request.
+func (s *cacheTestSite) LastRequest() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+// newCacheTest sets up an empty cache and a site serving body.
+func newCacheTest(t *testing.T, body string) (*cacheTestSite, string) {
+	t.Helper()
+	newTestEnv(t)
+	webCache = &httpCache{dir: t.TempDir()}
+	site := &cacheTestSite{body: body}
+	server := httptest.NewServer(site)
+	t.Cleanup(server.Close)
+	return site, server.URL + "/page"
+}
+
+// getBody fetches url with httpGet and returns the body.
+func getBody(t *testing.T, url string) string {
+	t.Helper()
+	res, err := httpGet(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestHTTPGetRevalidate(t *testing.T) {
+	site, url := newCacheTest(t, "first")
+	site.etag = `"v1"`
+	site.lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	if got := getBody(t, url); got != "first" {
+		t.Fatalf("body = %q", got)
+	}
+	if h := site.LastRequest(); h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" {
+		t.Errorf("first request was conditional: %v", h)
+	}
+
+	// The page is revalidated and the cached body served on 304.
+	site.body = "changed without new validators"
+	if got := getBody(t, url); got != "first" {
+		t.Errorf("body after 304 = %q, want the cached one", got)
+	}
+	h := site.LastRequest()
+	if h.Get("If-None-Match") != `"v1"` || h.Get("If-Modified-Since") != site.lastModified {
+		t.Errorf("revalidation headers = %v", h)
+	}
+	if n := site.Requests(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+
+	// A changed page replaces the cached one.
+	site.etag = `"v2"`
+	site.body = "second"
+	if got := getBody(t, url); got != "second" {
+		t.Errorf("body = %q, want the changed page", got)
+	}
+	if got := webCache.Load(url); got == nil || got.ETag != `"v2"` || string(got.Body) != "second" {
+		t.Errorf("cache entry = %+v, want the changed page", got)
+	}
+}
+
+func TestHTTPGetLastModified(t *testing.T) {
+	site, url := newCacheTest(t, "page")
+	site.lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	getBody(t, url)
+	if got := getBody(t, url); got != "page" {
+		t.Errorf("body = %q", got)
+	}
+	if h := site.LastRequest(); h.Get("If-Modified-Since") != site.lastModified || h.Get("If-None-Match") != "" {
+		t.Errorf("revalidation headers = %v", h)
+	}
+}
+
+func TestHTTPGetMaxAge(t *testing.T) {
+	site, url := newCacheTest(t, "page")
+	site.etag = `"v1"`
+	site.cacheControl = "public, max-age=3600"
+
+	getBody(t, url)
+	if got := getBody(t, url); got != "page" {
+		t.Errorf("body = %q", got)
+	}
+	if n := site.Requests(); n != 1 {
+		t.Errorf("got %d requests, want a fresh page to be served from the cache", n)
+	}
+}
+
+func TestHTTPGetNoCache(t *testing.T) {
+	site, url := newCacheTest(t, "page")
+	site.etag = `"v1"`
+	site.cacheControl = "no-cache, max-age=3600"
+
+	getBody(t, url)
+	getBody(t, url)
+	if n := site.Requests(); n != 2 {
+		t.Errorf("got %d requests, want no-cache to revalidate", n)
+	}
+	if h := site.LastRequest(); h.Get("If-None-Match") != `"v1"` {
+		t.Errorf("revalidation headers = %v", h)
+	}
+}
+
+func TestHTTPGetNoStore(t *testing.T) {
+	site, url := newCacheTest(t, "page")
+	site.etag = `"v1"`
+	site.cacheControl = "no-store"
+
+	if got := getBody(t, url); got != "page" {
+		t.Errorf("body = %q", got)
+	}
+	if webCache.Load(url) != nil {
+		t.Error("no-store response was cached")
+	}
+	getBody(t, url)
+	if h := site.LastRequest(); h.Get("If-None-Match") != "" {
+		t.Errorf("second request was conditional: %v", h)
+	}
+}
+
+func TestHTTPGetWithoutCache(t *testing.T) {
+	site, url := newCacheTest(t, "page")
+	site.etag = `"v1"`
+	site.cacheControl = "max-age=3600"
+
+	// --no-cache disables the cache for the command.
+	noCache, rest := cliNoCache([]string{"--no-cache", "some-project"})
+	if !noCache || !reflect.DeepEqual(rest, []string{"some-project"}) {
+		t.Fatalf("cliNoCache = %v, %q", noCache, rest)
+	}
+	webCache = nil
+	getBody(t, url)
+	getBody(t, url)
+	if n := site.Requests(); n != 2 {
+		t.Errorf("got %d requests, want every fetch to download the page", n)
+	}
+	if h := site.LastRequest(); h.Get("If-None-Match") != "" {
+		t.Errorf("request was conditional without cache: %v", h)
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	tests := []struct {
+		header string
+		want   cacheDirectives
+	}{
+		{"", cacheDirectives{}},
+		{"max-age=60", cacheDirectives{MaxAge: 60 * time.Second}},
+		{`public, MAX-AGE="30", no-cache`, cacheDirectives{MaxAge: 30 * time.Second, NoCache: true}},
+		{"no-store, max-age=soon", cacheDirectives{NoStore: true}},
+	}
+	for _, tt := range tests {
+		if got := parseCacheControl(tt.header); got != tt.want {
+			t.Errorf("parseCacheControl(%q) = %+v, want %+v", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// InitLogging sets up the default logger from the config. Logs are written to
+// stderr so that they don't mix with command output.
+func InitLogging(c *Config) {
+	opts := &slog.HandlerOptions{Level: c.logLevel()}
+	var h slog.Handler
+	if c.LogFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	}
+	stderrLog = slog.New(h)
+	slog.SetDefault(slog.New(multiHandler{h, discordHandler{sink: discordLog}}))
+}
+
+// stderrLog only writes to stderr. It is used by the Discord sink to avoid
+// logging its own failures to Discord.
+var stderrLog = slog.Default()
+
+// multiHandler passes records to all handlers that are enabled for them.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := make(multiHandler, 0, len(m))
+	for _, h := range m {
+		res = append(res, h.WithAttrs(attrs))
+	}
+	return res
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	res := make(multiHandler, 0, len(m))
+	for _, h := range m {
+		res = append(res, h.WithGroup(name))
+	}
+	return res
+}
+
+// discordSink forwards warnings and errors with a "guild" attribute to the
+// guild's #staff-bot-spam channel. Messages are sent in the background and
+// limited per channel, suppressed messages are counted in the next one.
+type discordSink struct {
+	mu         sync.Mutex
+	session    discordSession
+	sent       map[string][]time.Time // recent sends by channel
+	suppressed map[string]int         // dropped messages by channel
+	queue      chan discordLogMessage
+	done       chan struct{} // closed when the queue is drained after Stop
+	stopped    bool
+}
+
+type discordLogMessage struct {
+	ChannelID string
+	Content   string
+}
+
+// discordLogLimit is the number of log messages per minute and channel.
+const discordLogLimit = 5
+
+// discordLog is the Discord sink of the default logger. It drops all records
+// until Start is called.
+var discordLog = &discordSink{
+	sent:       make(map[string][]time.Time),
+	suppressed: make(map[string]int),
+	queue:      make(chan discordLogMessage, 100),
+}
+
+// Start forwards records to Discord using the session.
+func (d *discordSink) Start(s discordSession) {
+	d.mu.Lock()
+	d.session = s
+	d.done = make(chan struct{})
+	d.mu.Unlock()
+	go func() {
+		defer close(d.done)
+		for msg := range d.queue {
+			_, err := s.ChannelMessageSendComplex(msg.ChannelID, &discordgo.MessageSend{
+				Content:         msg.Content,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			})
+			if err != nil {
+				stderrLog.Error("could not send log message to Discord", "channel", msg.ChannelID, "error", err)
+			}
+		}
+	}()
+}
+
+// Stop drops further records and waits up to timeout for the queued ones to
+// be sent, so that they aren't lost when a command exits. It may be called
+// more than once.
+func (d *discordSink) Stop(timeout time.Duration) {
+	d.mu.Lock()
+	if d.session == nil || d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	d.stopped = true
+	d.session = nil
+	close(d.queue)
+	d.mu.Unlock()
+	select {
+	case <-d.done:
+	case <-time.After(timeout):
+		stderrLog.Warn("not all log messages were sent to Discord")
+	}
+}
+
+// discordHandler is a slog.Handler writing to a discordSink.
+type discordHandler struct {
+	sink   *discordSink
+	attrs  []slog.Attr
+	prefix string // group prefix for attribute keys
+}
+
+func (h discordHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+
+func (h discordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	res := h
+	res.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		res.attrs = append(res.attrs, a)
+	}
+	return res
+}
+
+func (h discordHandler) WithGroup(name string) slog.Handler {
+	res := h
+	res.prefix = h.prefix + name + "."
+	return res
+}
+
+func (h discordHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr{}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		a.Key = h.prefix + a.Key
+		attrs = append(attrs, a)
+		return true
+	})
+	var g *GuildConfig
+	var fields []string
+	for _, a := range attrs {
+		if a.Key == "guild" {
+			g = cfg.Guild(a.Value.String())
+			continue
+		}
+		fields = append(fields, fmt.Sprintf("%s=%s", a.Key, a.Value))
+	}
+	if g == nil {
+		// Logs without guild may contain details of other guilds.
+		return nil
+	}
+	content := fmt.Sprintf("`%s` %s", r.Level, r.Message)
+	if len(fields) > 0 {
+		content += " (" + strings.Join(fields, ", ") + ")"
+	}
+	h.sink.send(g.StaffBotSpamChannelID, truncate(content, 2000))
+	return nil
+}
+
+// send queues a message unless the channel's rate limit is exceeded.
+func (d *discordSink) send(channelID, content string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session == nil {
+		return
+	}
+	now := time.Now()
+	var recent []time.Time
+	for _, t := range d.sent[channelID] {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= discordLogLimit {
+		d.sent[channelID] = recent
+		d.suppressed[channelID]++
+		return
+	}
+	if n := d.suppressed[channelID]; n > 0 {
+		content = truncate(fmt.Sprintf("(%d log messages suppressed)\n%s", n, content), 2000)
+		d.suppressed[channelID] = 0
+	}
+	select {
+	case d.queue <- discordLogMessage{ChannelID: channelID, Content: content}:
+		d.sent[channelID] = append(recent, now)
+	default:
+		d.sent[channelID] = recent
+		d.suppressed[channelID]++
+	}
+}
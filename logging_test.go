@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordSink(t *testing.T) {
+	e := newTestEnv(t)
+	staff := e.Discord.AddChannel("staff-bot-spam")
+	e.Guild.StaffBotSpamChannelID = staff.ID
+	sink := &discordSink{
+		sent:       make(map[string][]time.Time),
+		suppressed: make(map[string]int),
+		queue:      make(chan discordLogMessage, 100),
+	}
+	old := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(old) })
+	slog.SetDefault(slog.New(discordHandler{sink: sink}))
+
+	// Records are dropped until the sink is started.
+	slog.Warn("before start", "guild", e.Guild.Name)
+	sink.Start(e.Discord)
+
+	// Entries in #current-projects that can't be parsed are reported to the
+	// staff, also from the command line.
+	e.Discord.Post(e.CurrentProjects.ID, "BROKEN\nDeadline: soon", day(-10))
+	if _, err := getCurrentProjects(context.Background(), e.Discord, e.Guild, false); err != nil {
+		t.Fatal(err)
+	}
+	slog.Warn("without guild")
+	slog.Info("not a warning", "guild", e.Guild.Name)
+
+	// Stop sends the queued records before returning.
+	sink.Stop(time.Second)
+	sink.Stop(time.Second)
+	slog.Warn("after stop", "guild", e.Guild.Name)
+
+	msgs := e.Discord.Messages(staff.ID)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want only the parse error: %+v", len(msgs), msgs)
+	}
+	if !strings.Contains(msgs[0].Content, "could not parse project") || !strings.Contains(msgs[0].Content, "BROKEN") {
+		t.Errorf("message = %q, want the parse error", msgs[0].Content)
+	}
+}
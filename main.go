@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
-	"github.com/bwmarrin/discordgo"
-	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/googleapi/transport"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 	"google.golang.org/api/youtube/v3"
@@ -20,196 +25,298 @@ import (
 var yt *youtube.Service
 var sheetsService *sheets.Service
 
-// InitGoogle initializes the YouTube and Sheets API clients.
-func InitGoogle(key string) error {
+// InitGoogle initializes the YouTube and Sheets API clients. If wrap is not
+// nil, it is applied to the transports of both clients. The endpoints can be
+// overridden in the config, e.g. to use the fake server.
+func InitGoogle(ctx context.Context, key string, wrap func(http.RoundTripper) http.RoundTripper) error {
 	var err error
-	yt, err = youtube.NewService(context.TODO(), option.WithAPIKey(key))
+	ytOptions := []option.ClientOption{option.WithAPIKey(key)}
+	if wrap != nil {
+		ytOptions[0] = option.WithHTTPClient(&http.Client{Transport: wrap(&transport.APIKey{Key: key})})
+	}
+	if cfg.YouTubeEndpoint != "" {
+		ytOptions = append(ytOptions, option.WithEndpoint(cfg.YouTubeEndpoint))
+	}
+	yt, err = youtube.NewService(ctx, ytOptions...)
 	if err != nil {
 		return err
 	}
-	data, err := ioutil.ReadFile("google_key.json")
+	if cfg.SheetsEndpoint != "" {
+		// The fake server doesn't need the service account.
+		sheetsOptions := []option.ClientOption{option.WithEndpoint(cfg.SheetsEndpoint), option.WithoutAuthentication()}
+		if wrap != nil {
+			sheetsOptions = append(sheetsOptions, option.WithHTTPClient(&http.Client{Transport: wrap(http.DefaultTransport)}))
+		}
+		sheetsService, err = sheets.NewService(ctx, sheetsOptions...)
+		return err
+	}
+	data, err := ioutil.ReadFile(cfg.GoogleKeyFile)
 	if err != nil {
-		return fmt.Errorf("could not retrieve google_key.json: %w", err)
+		return fmt.Errorf("could not retrieve %s: %w", cfg.GoogleKeyFile, err)
 	}
 	conf, err := google.JWTConfigFromJSON(data, "https://www.googleapis.com/auth/spreadsheets")
 	if err != nil {
 		return fmt.Errorf("could initialize service client: %w", err)
 	}
-	client := conf.Client(oauth2.NoContext)
-	sheetsService, err = sheets.NewService(context.TODO(), option.WithHTTPClient(client))
+	client := conf.Client(ctx)
+	if wrap != nil {
+		client.Transport = wrap(client.Transport)
+	}
+	sheetsService, err = sheets.NewService(ctx, option.WithHTTPClient(client))
 	return err
 }
 
 func usage() {
-	fmt.Printf("Usage: %s <command>\n", os.Args[0])
+	fmt.Printf("Usage: %s [-config file.json] [-guild name] <command> [arguments] [--format text|json] [--no-cache]\n", os.Args[0])
+	fmt.Println("The config file can also be set with UVEBOT_CONFIG.")
+	fmt.Println("Commands other than bot run for the first configured guild unless -guild is given.")
+	fmt.Println("--no-cache fetches all website pages again instead of using the cache.")
 	fmt.Println("Commands:")
 	fmt.Println(" - bot: start the Discord bot")
-	fmt.Println(" - get-current-projects")
-	fmt.Println(" - check-projects")
-	fmt.Println(" - check-releases")
-	fmt.Println(" - check-host-responses")
-	fmt.Println(" - get-website-projects")
+	fmt.Println(" - record [dir]: record the website, YouTube and Sheets responses for tests, to testdata/replay/<guild> by default")
+	fmt.Println(" - fake-server <data.json> [addr]: serve a fake website and YouTube and Sheets APIs on addr (default localhost:8080)")
+	for _, cmd := range commands {
+		fmt.Printf(" - %s: %s\n", cmd.Usage(), cmd.Help)
+	}
 }
 
 func main() {
 	token := os.Getenv("DISCORD_TOKEN")
 	youtubeKey := os.Getenv("GOOGLE_API_KEY")
 
-	if len(os.Args) < 2 {
+	configPath := flag.String("config", os.Getenv("UVEBOT_CONFIG"), "path to the JSON config file")
+	guildName := flag.String("guild", "", "name or ID of the guild for commands")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
 		usage()
 		os.Exit(1)
 	}
 
-	if youtubeKey != "" {
-		if err := InitGoogle(youtubeKey); err != nil {
-			fmt.Println("creating Google API client failed:", err)
-			return
+	// Commands and running jobs are canceled on CTRL-C or other term signal.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	cfg, err = LoadConfig(*configPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	InitLogging(cfg)
+	guild := cfg.Guilds[0]
+	if *guildName != "" {
+		guild = cfg.Guild(*guildName)
+		if guild == nil {
+			fmt.Printf("Unknown guild %s\n", *guildName)
+			os.Exit(1)
 		}
 	}
 
-	cmd := os.Args[1]
-	switch cmd {
-	case "bot":
-		if yt == nil {
-			fmt.Println("need a YouTube client!")
-			return
+	if flag.Arg(0) == "fake-server" {
+		if flag.NArg() < 2 {
+			usage()
+			os.Exit(1)
 		}
-		dg, err := InitBot(token, true)
-		if err != nil {
-			fmt.Println("error creating Discord session,", err)
-			return
+		addr := "localhost:8080"
+		if flag.NArg() > 2 {
+			addr = flag.Arg(2)
 		}
-		defer dg.Close()
-
-		c := InitCron(dg)
-		defer c.Stop()
+		if err := runFakeServer(ctx, flag.Arg(1), addr); err != nil {
+			fmt.Println("error: ", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-		// Wait here until CTRL-C or other term signal is received.
-		fmt.Println("Bot is now running.  Press CTRL-C to exit.")
-		sc := make(chan os.Signal, 1)
-		signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
-		<-sc
-
-	// Commands that need a discord session.
-	case "get-current-projects",
-		"check-projects":
-		dg, err := InitBot(token, false)
-		if err != nil {
-			fmt.Println("error creating Discord session,", err)
-			return
+	// Recording captures the responses of all website and Google requests.
+	var recorder *replayTransport
+	if flag.Arg(0) == "record" {
+		dir := filepath.Join("testdata", "replay", guild.Name)
+		if flag.NArg() > 1 {
+			dir = flag.Arg(1)
 		}
-		defer dg.Close()
+		recorder = &replayTransport{dir: dir, record: true}
+	}
 
-		res, err := handleCommand("!"+cmd, dg)
-		if err != nil {
-			fmt.Println("error: ", err)
+	if youtubeKey != "" {
+		var wrap func(http.RoundTripper) http.RoundTripper
+		if recorder != nil {
+			wrap = recorder.Wrap
+		}
+		if err := InitGoogle(ctx, youtubeKey, wrap); err != nil {
+			fmt.Println("creating Google API client failed:", err)
 			return
 		}
-		fmt.Println(res)
+	}
+
+	if cfg.CacheDir != "" {
+		webCache = &httpCache{dir: cfg.CacheDir}
+	}
 
-	// Commands that need a YouTube client
-	case "check-releases",
-		"check-host-responses":
-		dg, err := InitBot(token, false)
+	if recorder != nil {
+		// Cached pages wouldn't be recorded.
+		webCache = nil
+		webClient = &http.Client{Transport: recorder.Wrap(http.DefaultTransport)}
+		err := recordGuild(ctx, guild)
+		fmt.Println("recorded responses to", recorder.dir)
 		if err != nil {
-			fmt.Println("error creating Discord session,", err)
-			return
+			fmt.Println("error: ", err)
+			os.Exit(1)
 		}
-		defer dg.Close()
+		return
+	}
 
+	if flag.Arg(0) == "bot" {
 		if yt == nil {
 			fmt.Println("need a YouTube client!")
 			return
 		}
-
-		res, err := handleCommand("!"+cmd, dg)
+		store, err = OpenStore(cfg.StateFile)
 		if err != nil {
-			fmt.Println("error: ", err)
+			fmt.Println(err)
 			return
 		}
-		fmt.Println(res)
-
-	// Other commands
-	case "get-website-projects":
-		res, err := handleCommand("!"+cmd, nil)
+		defer store.Close()
+		dg, err := InitBot(ctx, token, true)
 		if err != nil {
-			fmt.Println("error: ", err)
+			fmt.Println("error creating Discord session,", err)
 			return
 		}
-		fmt.Println(res)
+		defer dg.Close()
+		discordLog.Start(dg)
+		// Runs before dg.Close so that queued log messages are still sent.
+		defer discordLog.Stop(cfg.requestTimeout())
+		if cfg.MetricsAddr != "" {
+			serveMetrics(ctx, cfg.MetricsAddr)
+		}
+
+		c := InitCron(ctx, dg)
+
+		// Wait here until CTRL-C or other term signal is received.
+		slog.Info("bot is now running, press CTRL-C to exit")
+		<-ctx.Done()
+		slog.Info("shutting down, waiting for running jobs to abort")
+		select {
+		case <-c.Stop().Done():
+		case <-time.After(cfg.requestTimeout()):
+			slog.Warn("jobs did not finish in time")
+		}
+		return
+	}
 
-	default:
-		fmt.Printf("Unknown command %s\n\n", os.Args[1])
+	cmd := lookupCommand(flag.Arg(0))
+	if cmd == nil {
+		fmt.Printf("Unknown command %s\n\n", flag.Arg(0))
 		usage()
 		os.Exit(1)
 	}
-}
-
-// handleCommand handles a bot command, returning the reply.
-func handleCommand(cmd string, dg *discordgo.Session) (string, error) {
-	switch cmd {
-	case "!get-current-projects":
-		projects, err := getCurrentProjects(dg, UVEGuildID)
-		if err != nil {
-			return "", err
-		}
-		var msg strings.Builder
-		for _, project := range projects {
-			fmt.Fprintf(&msg, "- %s due %s\n", project.ID, project.Deadline.Format("2006-01-02"))
+	format, words, err := cliFormat(flag.Args()[1:])
+	if err != nil {
+		fmt.Println("error: ", err)
+		os.Exit(1)
+	}
+	if noCache, rest := cliNoCache(words); noCache {
+		webCache = nil
+		words = rest
+	}
+	args, err := cmd.ParseArgs(words)
+	if err != nil {
+		fmt.Println("error: ", err)
+		os.Exit(1)
+	}
+	env := &commandEnv{Guild: guild, Args: args}
+	if needs := cmd.NeedsFor(args); needs&(NeedsStore|UsesStore) != 0 {
+		store, err = OpenStore(cfg.StateFile)
+		if err != nil && needs&NeedsStore != 0 {
+			fmt.Println(err)
+			return
 		}
-		return msg.String(), nil
-
-	case "!get-website-projects":
-		projects, err := getWebsiteProjects()
 		if err != nil {
-			return "", err
-		}
-		var msg strings.Builder
-		for _, project := range projects {
-			fmt.Fprintf(&msg, "- %s due %s\n", project.ID, project.Deadline.Format("2006-01-02"))
+			// e.g. the bot is running and holds the lock
+			fmt.Println("warning: continuing without state store, acknowledged findings are not filtered:", err)
+			store = nil
+		} else {
+			defer store.Close()
 		}
-		return msg.String(), nil
-
-	case "!check-projects":
-		res, err := checkCurrentProjects(dg, UVEGuildID)
+	}
+	if cmd.NeedsFor(args)&NeedsDiscord != 0 {
+		dg, err := InitBot(ctx, token, false)
 		if err != nil {
-			return "", err
-		}
-		if res == "" {
-			res = "All good!"
+			fmt.Println("error creating Discord session,", err)
+			return
 		}
-		return res, nil
-
-	case "!check-releases":
-		if yt == nil {
-			return "", fmt.Errorf("no YouTube credentials supplied")
+		defer dg.Close()
+		env.Session = dg
+		// Warnings go to #staff-bot-spam like in bot mode, e.g. entries in
+		// #current-projects that can't be parsed.
+		discordLog.Start(dg)
+		defer discordLog.Stop(cfg.requestTimeout())
+	}
+	res, err := runCommand(ctx, cmd, env)
+	if err != nil {
+		fmt.Println("error: ", err)
+		return
+	}
+	if format == "json" {
+		if res.Data == nil {
+			fmt.Printf("error: %s does not support --format json\n", cmd.Name)
+			discordLog.Stop(cfg.requestTimeout())
+			os.Exit(1)
 		}
-		res, err := checkReleases(yt)
-		if err != nil {
-			return "", err
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res.Data); err != nil {
+			fmt.Println("error: ", err)
 		}
-		if res == "" {
-			res = "All good!"
+	} else if len(res.Findings) > 0 {
+		fmt.Print(renderFindingsCLI(res.Findings))
+	} else if len(res.Failures) == 0 {
+		fmt.Println(res.Text)
+	}
+	if len(res.Failures) > 0 {
+		// Partial results were printed above, the failures go to stderr so
+		// that JSON output stays valid.
+		for _, f := range res.Failures {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", f.Check, f.Error)
 		}
-		return res, nil
+		discordLog.Stop(cfg.requestTimeout())
+		os.Exit(1)
+	}
+}
 
-	case "!check-host-responses":
-		if sheetsService == nil {
-			return "", fmt.Errorf("no Google Sheets credentials supplied")
+// cliFormat extracts the output format given as "--format json" or
+// "--format=json" from the command arguments.
+func cliFormat(words []string) (string, []string, error) {
+	format := "text"
+	var rest []string
+	for i := 0; i < len(words); i++ {
+		switch {
+		case words[i] == "--format" && i+1 < len(words):
+			format = words[i+1]
+			i++
+		case strings.HasPrefix(words[i], "--format="):
+			format = words[i][len("--format="):]
+		default:
+			rest = append(rest, words[i])
 		}
-		responses, err := checkHostResponses(sheetsService)
-		if err != nil {
-			return "", err
-		}
-		res := ""
-		for _, response := range responses {
-			channel, err := createProposedProjectChannel(dg, &response)
-			if err != nil {
-				return "", err
-			}
-			res += response.Message + fmt.Sprintf(" <#%s>\n", channel.ID)
+	}
+	if format != "text" && format != "json" {
+		return "", nil, fmt.Errorf("unknown format %q, expected text or json", format)
+	}
+	return format, rest, nil
+}
+
+// cliNoCache extracts the --no-cache flag from the command arguments.
+func cliNoCache(words []string) (bool, []string) {
+	var rest []string
+	found := false
+	for _, w := range words {
+		if w == "--no-cache" {
+			found = true
+		} else {
+			rest = append(rest, w)
 		}
-		return res, nil
 	}
-	return "", fmt.Errorf("unknown command %s", cmd)
+	return found, rest
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics exported on /metrics. Guilds are labeled with their configured
+// name.
+var (
+	metricCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "uvebot_command_invocations_total",
+		Help: "Number of commands run, by result (ok or error).",
+	}, []string{"guild", "command", "result"})
+	metricCheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "uvebot_check_duration_seconds",
+		Help:    "Time spent running a check after its data was prefetched.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"guild", "check"})
+	metricCheckFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "uvebot_check_failures_total",
+		Help: "Number of errors reported by checks.",
+	}, []string{"guild", "check"})
+	metricFindings = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "uvebot_check_findings",
+		Help: "Number of open findings per check after the last scheduled run.",
+	}, []string{"guild", "check"})
+	metricJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "uvebot_job_duration_seconds",
+		Help:    "Duration of cron jobs.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 3, 8),
+	}, []string{"guild", "job"})
+	metricJobLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "uvebot_job_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of a cron job.",
+	}, []string{"guild", "job"})
+	metricOutboundErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "uvebot_outbound_errors_total",
+		Help: "Number of failed attempts of outbound calls, by service (website, discord, youtube or sheets).",
+	}, []string{"service"})
+	metricHostResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "uvebot_host_responses_processed_total",
+		Help: "Number of host responses for which a channel was created, by result (ok or error).",
+	}, []string{"guild", "result"})
+)
+
+// resultLabel returns the result label for an error.
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// healthState tracks what /healthz reports.
+type healthState struct {
+	mu          sync.Mutex
+	connected   bool                            // Discord gateway connection
+	lastSuccess map[string]map[string]time.Time // end of the last successful run by guild and job
+}
+
+var health = &healthState{lastSuccess: make(map[string]map[string]time.Time)}
+
+// Track updates the connection state from the session's gateway events.
+func (h *healthState) Track(s *discordgo.Session) {
+	s.AddHandler(func(s *discordgo.Session, e *discordgo.Connect) { h.setConnected(true) })
+	s.AddHandler(func(s *discordgo.Session, e *discordgo.Disconnect) { h.setConnected(false) })
+}
+
+func (h *healthState) setConnected(connected bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.connected = connected
+}
+
+// JobSucceeded records a successful job run.
+func (h *healthState) JobSucceeded(g *GuildConfig, job string, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastSuccess[g.Name] == nil {
+		h.lastSuccess[g.Name] = make(map[string]time.Time)
+	}
+	h.lastSuccess[g.Name][job] = t
+}
+
+// healthResponse is the body of /healthz.
+type healthResponse struct {
+	DiscordConnected bool                            `json:"discord_connected"`
+	LastSuccess      map[string]map[string]time.Time `json:"last_success"` // by guild and job
+}
+
+// ServeHTTP reports the health as JSON. The status is 503 while the Discord
+// gateway is disconnected.
+func (h *healthState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	res := healthResponse{DiscordConnected: h.connected, LastSuccess: make(map[string]map[string]time.Time)}
+	for guild, jobs := range h.lastSuccess {
+		res.LastSuccess[guild] = make(map[string]time.Time)
+		for job, t := range jobs {
+			res.LastSuccess[guild][job] = t
+		}
+	}
+	h.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if !res.DiscordConnected {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// serveMetrics serves /metrics and /healthz on addr until ctx is done.
+func serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", health)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		slog.Info("serving metrics", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", "addr", addr, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// checkPermission returns an error explaining the denial if the member may not
+// run the command in the given channel.
+func checkPermission(g *GuildConfig, cmd string, member *discordgo.Member, channelID string) error {
+	perm := g.Permissions[cmd]
+	if perm == nil {
+		return nil
+	}
+	if len(perm.Channels) > 0 && !contains(perm.Channels, channelID) {
+		return fmt.Errorf("the %s command can only be used in %s", cmd, joinMentions("<#%s>", perm.Channels))
+	}
+	if len(perm.Roles) > 0 {
+		if member != nil {
+			for _, role := range member.Roles {
+				if contains(perm.Roles, role) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("the %s command requires one of the roles %s", cmd, joinMentions("<@&%s>", perm.Roles))
+	}
+	return nil
+}
+
+// auditDenied records a refused command in the log and in #staff-bot-spam. The
+// audit message is posted directly instead of through the rate limited log
+// sink so that none get lost. Callers respond to the user first since this
+// may be slow.
+func auditDenied(s *discordgo.Session, g *GuildConfig, cmd string, user *discordgo.User, channelID string, reason error) {
+	slog.Info("permission denied", "guild", g.Name, "command", cmd, "user", user.ID, "channel", channelID, "reason", reason)
+	line := fmt.Sprintf("denied %s for %s (%s) in <#%s>: %s", cmd, user.Username, user.ID, channelID, reason)
+	err := sendMessage(s, g.StaffBotSpamChannelID, &discordgo.MessageSend{
+		Content:         line,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		slog.Error("could not post audit message", "guild", g.Name, "command", cmd, "error", err)
+	}
+}
+
+func joinMentions(format string, ids []string) string {
+	mentions := make([]string, 0, len(ids))
+	for _, id := range ids {
+		mentions = append(mentions, fmt.Sprintf(format, id))
+	}
+	return strings.Join(mentions, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
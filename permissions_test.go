@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCheckPermission(t *testing.T) {
+	g := &GuildConfig{Permissions: map[string]*CommandPermission{
+		"channel-only": {Channels: []string{"10"}},
+		"role-only":    {Roles: []string{"20"}},
+		"both":         {Roles: []string{"20"}, Channels: []string{"10"}},
+	}}
+	member := &discordgo.Member{Roles: []string{"20"}}
+	other := &discordgo.Member{Roles: []string{"21"}}
+	tests := []struct {
+		cmd     string
+		member  *discordgo.Member
+		channel string
+		allowed bool
+	}{
+		{"unrestricted", nil, "11", true},
+		{"channel-only", nil, "10", true},
+		{"channel-only", other, "11", false},
+		{"role-only", member, "11", true},
+		{"role-only", other, "11", false},
+		{"role-only", nil, "11", false},
+		{"both", member, "10", true},
+		{"both", member, "11", false},
+		{"both", other, "10", false},
+		{"both", nil, "10", false},
+	}
+	for _, tt := range tests {
+		err := checkPermission(g, tt.cmd, tt.member, tt.channel)
+		if (err == nil) != tt.allowed {
+			t.Errorf("checkPermission(%s, %+v, %s) = %v, want allowed: %v", tt.cmd, tt.member, tt.channel, err, tt.allowed)
+		}
+	}
+
+	// The denial fits both text and slash commands.
+	err := checkPermission(g, "both", member, "11")
+	if want := "the both command can only be used in <#10>"; err == nil || err.Error() != want {
+		t.Errorf("denial = %v, want %q", err, want)
+	}
+}
+
+func TestPermissionDefaults(t *testing.T) {
+	g := &GuildConfig{TechTeamRoleID: "200", Permissions: map[string]*CommandPermission{
+		"snooze":               {Channels: []string{"10"}},
+		"unsnooze":             {Roles: []string{}},
+		"check-host-responses": nil,
+		"check-website":        {Roles: []string{"20"}},
+	}}
+	g.applyDefaults()
+	want := map[string]*CommandPermission{
+		"snooze":               {Roles: []string{"200"}, Channels: []string{"10"}},
+		"unsnooze":             {Roles: []string{}},
+		"check-host-responses": nil,
+		"check-website":        {Roles: []string{"20"}},
+	}
+	if !reflect.DeepEqual(g.Permissions, want) {
+		t.Errorf("permissions = %+v, want the config merged into the defaults", g.Permissions)
+	}
+
+	// Without permissions in the config, all defaults apply.
+	g = &GuildConfig{TechTeamRoleID: "200"}
+	g.applyDefaults()
+	if len(g.Permissions) != 3 || g.Permissions["snooze"] == nil || !reflect.DeepEqual(g.Permissions["snooze"].Roles, []string{"200"}) {
+		t.Errorf("permissions = %+v, want the defaults", g.Permissions)
+	}
+}
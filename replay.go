@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// replayTransport records HTTP responses to a directory or replays them
+// from there. It is used to capture the website and Google APIs for offline
+// tests.
+type replayTransport struct {
+	dir    string
+	record bool              // record responses from base instead of replaying
+	base   http.RoundTripper // transport for recording
+}
+
+// recording is a recorded response. URLs don't include API keys.
+type recording struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// errNoRecording is returned when replaying a request that wasn't recorded.
+var errNoRecording = errors.New("no recording")
+
+// recordedHeaders are the response headers that are kept in recordings.
+var recordedHeaders = []string{"Content-Type", "Cache-Control", "ETag", "Last-Modified", "Retry-After"}
+
+// recordingURL returns the URL under which a request is recorded. The API key
+// is removed so that it doesn't end up in the recordings.
+func recordingURL(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	if q.Has("key") {
+		q.Del("key")
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// Wrap returns a copy of the transport that records from base.
+func (t *replayTransport) Wrap(base http.RoundTripper) http.RoundTripper {
+	c := *t
+	c.base = base
+	return &c
+}
+
+func (t *replayTransport) path(method, url string) string {
+	sum := sha1.Sum([]byte(method + " " + url))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := recordingURL(req)
+	if !t.record {
+		data, err := os.ReadFile(t.path(req.Method, url))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w of %s %s", errNoRecording, req.Method, url)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec recording
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("invalid recording of %s %s: %w", req.Method, url, err)
+		}
+		return rec.Response(req), nil
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	rec := &recording{Method: req.Method, URL: url, Status: res.StatusCode, Header: make(http.Header), Body: string(body)}
+	for _, h := range recordedHeaders {
+		if v := res.Header.Get(h); v != "" {
+			rec.Header.Set(h, v)
+		}
+	}
+	if err := t.save(rec); err != nil {
+		return nil, fmt.Errorf("could not record %s %s: %w", req.Method, url, err)
+	}
+	return rec.Response(req), nil
+}
+
+func (t *replayTransport) save(rec *recording) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	// Keep HTML readable in the recordings.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rec); err != nil {
+		return err
+	}
+	return os.WriteFile(t.path(rec.Method, rec.URL), buf.Bytes(), 0644)
+}
+
+// Response returns the recorded response to req.
+func (rec *recording) Response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(rec.Body))),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}
+}
+
+// recordGuild fetches everything the checks read over HTTP for the guild so
+// that the responses are recorded. Website requests must go through a
+// recording webClient and the Google clients must be set up with a recording
+// transport. Failed fetches are reported, the others are still recorded.
+func recordGuild(ctx context.Context, g *GuildConfig) error {
+	var errs partErrors
+	projects, err := getWebsiteProjects(ctx, g)
+	if err != nil {
+		errs.add(fmt.Errorf("website projects: %w", err))
+	} else {
+		errs.add(fetchWebsiteProjectLinks(ctx, g, projects))
+	}
+	if _, err := getWebsiteReleases(ctx, g); err != nil {
+		errs.add(fmt.Errorf("website releases: %w", err))
+	}
+	if yt != nil && g.PlaylistID != "" {
+		if _, err := getYoutubeVideos(ctx, yt, g); err != nil {
+			errs.add(fmt.Errorf("YouTube playlist: %w", err))
+		}
+	}
+	if sheetsService != nil && g.HostResponsesSheetID != "" {
+		// A dry run doesn't advance the last row id.
+		if _, err := checkHostResponses(ctx, sheetsService, g, true); err != nil {
+			errs.add(fmt.Errorf("host responses: %w", err))
+		}
+	}
+	return errs.err()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+	"google.golang.org/api/youtube/v3"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// replaySet is a set of responses the golden tests replay, in
+// testdata/<dir>/<guild>, with golden files in testdata/golden/<name>.
+type replaySet struct {
+	Name     string
+	Dir      string
+	Optional bool // skip the tests if there are no responses
+}
+
+// replaySets are the response sets the golden tests run against.
+//
+// The synthetic responses are NOT real recordings: the website HTML, the
+// YouTube playlist pages and the Sheets rows were written by hand in the
+// format replayTransport saves. They test the replay mechanism and the parsing
+// of responses of the expected shape, but can't catch changes of the live
+// site.
+//
+// The recorded responses are captured from the live site and APIs with
+// `uvebot record`, which writes them to testdata/replay/<guild> without API
+// keys. After recording, run go test -update to write their golden files and
+// commit both. The golden tests then fail when scraping the recorded pages
+// gives different results, e.g. after recording again once the site changed.
+var replaySets = []replaySet{
+	{Name: "synthetic", Dir: "synthetic"},
+	{Name: "recorded", Dir: "replay", Optional: true},
+}
+
+// syntheticSet is the replay set for tests of the replay mechanism.
+var syntheticSet = replaySets[0]
+
+// forEachReplaySet runs fn as subtest for every replay set with the default
+// guild set up to replay its responses.
+func forEachReplaySet(t *testing.T, fn func(t *testing.T, g *GuildConfig, set replaySet)) {
+	for _, set := range replaySets {
+		t.Run(set.Name, func(t *testing.T) {
+			fn(t, replayGuild(t, set), set)
+		})
+	}
+}
+
+// replayGuild sets up the clients to replay the responses of the set for the
+// default guild.
+func replayGuild(t *testing.T, set replaySet) *GuildConfig {
+	t.Helper()
+	oldCfg, oldCache, oldClient, oldYT, oldSheets := cfg, webCache, webClient, yt, sheetsService
+	t.Cleanup(func() { cfg, webCache, webClient, yt, sheetsService = oldCfg, oldCache, oldClient, oldYT, oldSheets })
+	cfg = DefaultConfig()
+	cfg.RequestsPerHost = 1000
+	g := cfg.Guilds[0]
+	g.applyDefaults()
+
+	dir := filepath.Join("testdata", set.Dir, g.Name)
+	if _, err := os.Stat(dir); set.Optional && errors.Is(err, os.ErrNotExist) {
+		t.Skipf("no %s responses in %s, capture them with `uvebot record`", set.Name, dir)
+	}
+	client := &http.Client{Transport: &replayTransport{dir: dir}}
+	webCache = nil
+	webClient = client
+	var err error
+	ctx := context.Background()
+	if yt, err = youtube.NewService(ctx, option.WithHTTPClient(client)); err != nil {
+		t.Fatal(err)
+	}
+	if sheetsService, err = sheets.NewService(ctx, option.WithHTTPClient(client)); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// checkGolden compares v as JSON with the golden file
+// testdata/golden/<set>/<name>.json.
+func checkGolden(t *testing.T, set replaySet, name string, v any) {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join("testdata", "golden", set.Name, name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, buf.String())
+	}
+}
+
+// errorStrings returns the messages of the parts of err.
+func errorStrings(err error) []string {
+	var res []string
+	var errs partErrors
+	errs.add(err)
+	for _, err := range errs {
+		res = append(res, err.Error())
+	}
+	return res
+}
+
+func TestReplayWebsiteProjects(t *testing.T) {
+	forEachReplaySet(t, func(t *testing.T, g *GuildConfig, set replaySet) {
+		ctx := context.Background()
+		projects, err := getWebsiteProjects(ctx, g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = fetchWebsiteProjectLinks(ctx, g, projects)
+
+		// The year of the deadlines and thus the order of the projects depends
+		// on the current date.
+		sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+		type goldenProject struct {
+			ID   string   `json:"id"`
+			Name string   `json:"name"`
+			Due  string   `json:"due"`
+			URLs []string `json:"urls"`
+		}
+		res := struct {
+			Projects []goldenProject `json:"projects"`
+			Errors   []string        `json:"errors"`
+		}{Errors: errorStrings(err)}
+		for _, p := range projects {
+			res.Projects = append(res.Projects, goldenProject{p.ID, p.Name, p.Deadline.Format("January 2"), p.URLs})
+		}
+		checkGolden(t, set, "website-projects", res)
+	})
+}
+
+func TestReplayWebsiteReleases(t *testing.T) {
+	forEachReplaySet(t, func(t *testing.T, g *GuildConfig, set replaySet) {
+		ids, err := getWebsiteReleases(context.Background(), g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, set, "website-releases", ids)
+	})
+}
+
+func TestReplayYoutubeVideos(t *testing.T) {
+	forEachReplaySet(t, func(t *testing.T, g *GuildConfig, set replaySet) {
+		videos, err := getYoutubeVideos(context.Background(), yt, g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		type goldenVideo struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		}
+		var res []goldenVideo
+		for _, v := range videos {
+			res = append(res, goldenVideo{v.ContentDetails.VideoId, v.Snippet.Title})
+		}
+		checkGolden(t, set, "youtube-videos", res)
+	})
+}
+
+func TestReplayHostResponses(t *testing.T) {
+	forEachReplaySet(t, func(t *testing.T, g *GuildConfig, set replaySet) {
+		responses, err := checkHostResponses(context.Background(), sheetsService, g, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGolden(t, set, "host-responses", responses)
+	})
+}
+
+func TestReplayMissingRecording(t *testing.T) {
+	g := replayGuild(t, syntheticSet)
+	_, err := httpGetDoc(context.Background(), g.WebsiteURL+"/not-recorded")
+	if !errors.Is(err, errNoRecording) {
+		t.Errorf("err = %v, want errNoRecording", err)
+	}
+}
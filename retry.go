@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/api/googleapi"
+)
+
+// retryPolicy configures how often and how long failed calls are retried.
+type retryPolicy struct {
+	Attempts int           // total number of attempts
+	Base     time.Duration // backoff before the first retry
+	Max      time.Duration // maximum backoff, also for Retry-After
+}
+
+// Services with outbound calls, used in logs and metrics.
+const (
+	serviceWebsite = "website"
+	serviceDiscord = "discord"
+	serviceYouTube = "youtube"
+	serviceSheets  = "sheets"
+)
+
+// defaultRetry is used for all outbound calls.
+var defaultRetry = retryPolicy{Attempts: 4, Base: 500 * time.Millisecond, Max: 30 * time.Second}
+
+// statusError is an unexpected HTTP status code.
+type statusError struct {
+	Code       int
+	URL        string
+	RetryAfter time.Duration // from the Retry-After header, zero if not sent
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d (getting %s)", e.Code, e.URL)
+}
+
+// retry calls fn until it succeeds, returns a permanent error or the attempts
+// are exhausted. Every attempt gets a context limited to the configured
+// request timeout. Between attempts, it waits with exponential backoff and
+// full jitter, or as long as the server asked to. Retrying stops when ctx is
+// done. The service and name describe the call in logs and metrics.
+func retry(ctx context.Context, service, name string, fn func(ctx context.Context) error) error {
+	return defaultRetry.Do(ctx, service, name, fn)
+}
+
+// retryValue is retry for functions returning a value.
+func retryValue[T any](ctx context.Context, service, name string, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := retry(ctx, service, name, func(ctx context.Context) (err error) {
+		v, err = fn(ctx)
+		return err
+	})
+	return v, err
+}
+
+// Do implements retry for the policy.
+func (p retryPolicy) Do(ctx context.Context, service, name string, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = attemptWithTimeout(ctx, fn)
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("retry succeeded", "service", service, "op", name, "retries", attempt-1)
+			}
+			return nil
+		}
+		metricOutboundErrors.WithLabelValues(service).Inc()
+		if ctx.Err() != nil {
+			return err
+		}
+		retryable, after := retryable(err)
+		if !retryable || attempt >= p.Attempts {
+			break
+		}
+		if after > p.Max {
+			// Waiting that long would block the job, so give up instead.
+			slog.Warn("not retrying, server asked to wait too long", "service", service, "op", name, "attempt", attempt, "retry_after", after, "error", err)
+			return fmt.Errorf("%w (retry after %v)", err, after)
+		}
+		wait := p.backoff(attempt)
+		if after > wait {
+			wait = after
+		}
+		slog.Warn("attempt failed, retrying", "service", service, "op", name, "attempt", attempt, "attempts", p.Attempts, "wait", wait.Round(time.Millisecond), "error", err)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// attemptWithTimeout calls fn with a context limited to the request timeout.
+func attemptWithTimeout(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.requestTimeout())
+	defer cancel()
+	return fn(ctx)
+}
+
+// sleep waits for d or until ctx is done, returning the context's error in
+// the latter case.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backoff returns a random duration up to the exponential backoff for the
+// given attempt.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.Base << (attempt - 1)
+	if d > p.Max || d <= 0 {
+		d = p.Max
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// retryable reports whether err is transient and how long the server asked
+// to wait before retrying, if at all.
+func retryable(err error) (bool, time.Duration) {
+	if errors.Is(err, errNoRecording) {
+		return false, 0
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return retryableStatus(se.Code), se.RetryAfter
+	}
+	var ge *googleapi.Error
+	if errors.As(err, &ge) {
+		return retryableStatus(ge.Code), parseRetryAfter(ge.Header.Get("Retry-After"))
+	}
+	var re *discordgo.RESTError
+	if errors.As(err, &re) {
+		if re.Response == nil {
+			return false, 0
+		}
+		return retryableStatus(re.Response.StatusCode), parseRetryAfter(re.Response.Header.Get("Retry-After"))
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The request timeout of a single attempt.
+		return true, 0
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		// Includes timeouts and failed connections, which are wrapped in
+		// *url.Error.
+		return true, 0
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true, 0
+	}
+	return false, 0
+}
+
+// retryableStatus reports whether a request with the HTTP status code may
+// succeed when tried again.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as HTTP
+// date. It returns zero if the header is empty or invalid.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
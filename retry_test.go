@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/api/googleapi"
+)
+
+func TestRetryable(t *testing.T) {
+	discordError := func(code int, header http.Header) error {
+		return &discordgo.RESTError{Response: &http.Response{StatusCode: code, Header: header}}
+	}
+	tests := []struct {
+		name  string
+		err   error
+		want  bool
+		after time.Duration
+	}{
+		{"status 404", &statusError{Code: 404}, false, 0},
+		{"status 429", &statusError{Code: 429, RetryAfter: 3 * time.Second}, true, 3 * time.Second},
+		{"status 503", fmt.Errorf("wrapped: %w", &statusError{Code: 503}), true, 0},
+		{"google 403", &googleapi.Error{Code: 403}, false, 0},
+		{"google 500", &googleapi.Error{Code: 500}, true, 0},
+		{"google 429", &googleapi.Error{Code: 429, Header: http.Header{"Retry-After": {"7"}}}, true, 7 * time.Second},
+		{"discord 404", discordError(404, nil), false, 0},
+		{"discord 502", discordError(502, nil), true, 0},
+		{"discord 429", discordError(429, http.Header{"Retry-After": {"2"}}), true, 2 * time.Second},
+		{"discord without response", &discordgo.RESTError{}, false, 0},
+		{"net error", &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true, 0},
+		{"unexpected EOF", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true, 0},
+		{"attempt timeout", context.DeadlineExceeded, true, 0},
+		{"canceled", context.Canceled, false, 0},
+		{"no recording", fmt.Errorf("%w of GET /", errNoRecording), false, 0},
+		{"other", errors.New("invalid HTML"), false, 0},
+	}
+	for _, tt := range tests {
+		got, after := retryable(tt.err)
+		if got != tt.want || after != tt.after {
+			t.Errorf("%s: retryable = %v, %v, want %v, %v", tt.name, got, after, tt.want, tt.after)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("120"); got != 2*time.Minute {
+		t.Errorf("seconds: got %v, want 2m", got)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("HTTP date: got %v, want about an hour", got)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	for _, header := range []string{"", "0", "-5", "soon", "1.5", past} {
+		if got := parseRetryAfter(header); got != 0 {
+			t.Errorf("parseRetryAfter(%q) = %v, want 0", header, got)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{Attempts: 10, Base: time.Second, Max: 30 * time.Second}
+	for attempt := 1; attempt <= 70; attempt++ {
+		limit := p.Base << (attempt - 1)
+		if attempt > 5 {
+			limit = p.Max
+		}
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt); d < 0 || d > limit {
+				t.Fatalf("backoff(%d) = %v, want at most %v", attempt, d, limit)
+			}
+		}
+	}
+}
+
+// testRetry is a policy with short waits for tests.
+var testRetry = retryPolicy{Attempts: 3, Base: time.Millisecond, Max: 2 * time.Millisecond}
+
+func TestRetryDo(t *testing.T) {
+	ctx := context.Background()
+
+	// Transient errors are retried until the call succeeds.
+	calls := 0
+	err := testRetry.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return &statusError{Code: 503}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("transient: err = %v after %d calls, want success after 3", err, calls)
+	}
+
+	// Transient errors are returned when the attempts are exhausted.
+	calls = 0
+	err = testRetry.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		calls++
+		return &statusError{Code: 503}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("exhausted: err = %v after %d calls, want an error after 3", err, calls)
+	}
+
+	// Permanent errors are not retried.
+	calls = 0
+	err = testRetry.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		calls++
+		return &statusError{Code: 404}
+	})
+	var se *statusError
+	if !errors.As(err, &se) || calls != 1 {
+		t.Errorf("permanent: err = %v after %d calls, want the status error after 1", err, calls)
+	}
+
+	// A Retry-After up to the maximum backoff is honored.
+	calls = 0
+	err = testRetry.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return &statusError{Code: 429, RetryAfter: testRetry.Max}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Retry-After: err = %v after %d calls, want success after 2", err, calls)
+	}
+
+	// A longer Retry-After is treated as permanent.
+	calls = 0
+	start := time.Now()
+	err = testRetry.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		calls++
+		return &statusError{Code: 429, RetryAfter: time.Hour}
+	})
+	if !errors.As(err, &se) || se.Code != 429 || calls != 1 {
+		t.Errorf("long Retry-After: err = %v after %d calls, want the status error after 1", err, calls)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("long Retry-After: waited %v", d)
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	// Retrying stops when the context is canceled during an attempt.
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := testRetry.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		calls++
+		cancel()
+		return &statusError{Code: 503}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("canceled: err = %v after %d calls, want an error after 1", err, calls)
+	}
+
+	// A Retry-After within the limit is cut short by the context.
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	slow := retryPolicy{Attempts: 3, Base: time.Millisecond, Max: time.Hour}
+	err = slow.Do(ctx, serviceWebsite, "test", func(ctx context.Context) error {
+		return &statusError{Code: 429, RetryAfter: time.Hour}
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Retry-After: err = %v, want the context's error", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Retry-After: waited %v", d)
+	}
+
+	// Each attempt gets the request timeout.
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	cfg = DefaultConfig()
+	err = testRetry.Do(context.Background(), serviceWebsite, "test", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
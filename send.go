@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// messageLimit is Discord's maximum message length in characters.
+const messageLimit = 2000
+
+// maxMessageParts is the maximum number of messages a long text is split
+// into. Longer texts are attached as a file instead.
+const maxMessageParts = 4
+
+// splitMessage splits content into parts of at most limit characters. It
+// breaks between lines, only lines that are too long by themselves are split
+// in the middle.
+func splitMessage(content string, limit int) []string {
+	var parts []string
+	var cur strings.Builder
+	curLen := 0
+	flush := func() {
+		if s := strings.TrimRight(cur.String(), "\n"); s != "" {
+			parts = append(parts, s)
+		}
+		cur.Reset()
+		curLen = 0
+	}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		n := utf8.RuneCountInString(strings.TrimRight(line, "\n"))
+		if curLen+n > limit {
+			flush()
+		}
+		for n > limit {
+			r := []rune(line)
+			parts = append(parts, string(r[:limit]))
+			line = string(r[limit:])
+			n -= limit
+		}
+		cur.WriteString(line)
+		curLen += utf8.RuneCountInString(line)
+	}
+	flush()
+	return parts
+}
+
+// sendMessage sends a message that may be longer than Discord's limit. The
+// content is split on line boundaries into several messages, with embeds and
+// components attached to the last one. If that would take more than
+// maxMessageParts messages, the content is attached as a file with only its
+// first line, e.g. a ping, in the message.
+func sendMessage(s discordSession, channelID string, data *discordgo.MessageSend) error {
+	parts := splitMessage(data.Content, messageLimit)
+	if len(parts) > maxMessageParts {
+		msg := *data
+		first, _, _ := strings.Cut(data.Content, "\n")
+		msg.Content = truncate(first, messageLimit-30) + "\n(full text in the attachment)"
+		msg.Files = append([]*discordgo.File{{
+			Name:        "message.md",
+			ContentType: "text/markdown; charset=utf-8",
+			Reader:      strings.NewReader(data.Content),
+		}}, data.Files...)
+		_, err := s.ChannelMessageSendComplex(channelID, &msg)
+		return err
+	}
+	if len(parts) == 0 {
+		// only embeds or files
+		parts = []string{""}
+	}
+	for i, part := range parts {
+		msg := &discordgo.MessageSend{Content: part, AllowedMentions: data.AllowedMentions}
+		if i == 0 {
+			msg.Reference = data.Reference
+		}
+		if i == len(parts)-1 {
+			msg.Embeds = data.Embeds
+			msg.Components = data.Components
+			msg.Files = data.Files
+		}
+		if _, err := s.ChannelMessageSendComplex(channelID, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fitMessage shortens content to Discord's limit for messages that can't be
+// split, e.g. because they are edited in place. Whole lines are dropped from
+// the end.
+func fitMessage(content string) string {
+	if utf8.RuneCountInString(content) <= messageLimit {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for n := len(lines) - 1; n > 0; n-- {
+		res := fmt.Sprintf("%s\n(%d more lines not shown)", strings.Join(lines[:n], "\n"), len(lines)-n)
+		if utf8.RuneCountInString(res) <= messageLimit {
+			return res
+		}
+	}
+	return truncate(content, messageLimit)
+}
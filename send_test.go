@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		content string
+		limit   int
+		want    []string
+	}{
+		{"", 10, nil},
+		{"short", 10, []string{"short"}},
+		{"one\ntwo\nthree", 10, []string{"one\ntwo", "three"}},
+		{"one\ntwo\nthree", 7, []string{"one\ntwo", "three"}},
+		{"abcdefghij\nk", 4, []string{"abcd", "efgh", "ij\nk"}},
+		{"äöü\näöü", 3, []string{"äöü", "äöü"}},
+	}
+	for _, tt := range tests {
+		got := splitMessage(tt.content, tt.limit)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitMessage(%q, %d) = %q, want %q", tt.content, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// testLines returns n lines of 99 characters each.
+func testLines(n int) string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", 99)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestSendMessage(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.TechTeam.ID
+	components := snoozeComponents([]Finding{{Check: "missing-projects", Subject: "new", Name: "New"}})
+
+	// A long report is split, with the buttons on the last part.
+	if err := sendMessage(e.Discord, c, &discordgo.MessageSend{Content: testLines(30), Components: components}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := e.Discord.Messages(c)
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+	if msgs[0].Components != nil || msgs[1].Components == nil {
+		t.Error("components should only be on the last message")
+	}
+	if got := msgs[0].Content + "\n" + msgs[1].Content; got != testLines(30) {
+		t.Error("split messages don't add up to the content")
+	}
+
+	// A huge report is attached as a file.
+	content := "<@&200>\n" + testLines(100)
+	if err := sendMessage(e.Discord, c, &discordgo.MessageSend{Content: content}); err != nil {
+		t.Fatal(err)
+	}
+	msgs = e.Discord.Messages(c)
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want one more", len(msgs))
+	}
+	msg := msgs[2]
+	if !strings.HasPrefix(msg.Content, "<@&200>\n") {
+		t.Errorf("message = %q, want the ping", msg.Content)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "message.md" || msg.Attachments[0].Size != len(content) {
+		t.Errorf("attachments = %+v, want the full content", msg.Attachments)
+	}
+
+	// Errors are returned instead of being dropped.
+	e.Discord.Fail("ChannelMessageSendComplex", c, errors.New("missing permissions"))
+	if err := sendMessage(e.Discord, c, &discordgo.MessageSend{Content: "hi"}); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFitMessage(t *testing.T) {
+	if got := fitMessage("short"); got != "short" {
+		t.Errorf("fitMessage(short) = %q", got)
+	}
+	got := fitMessage(testLines(30))
+	if n := len([]rune(got)); n > messageLimit {
+		t.Errorf("fitMessage returned %d characters", n)
+	}
+	if !strings.HasSuffix(got, "(11 more lines not shown)") {
+		t.Errorf("fitMessage = ...%q, want the number of dropped lines", got[len(got)-40:])
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store keeps the bot's state in a local bbolt database. All values are stored
+// as JSON in per-guild buckets.
+type Store struct {
+	db *bolt.DB
+}
+
+// store is the open state store, set up in main.
+var store *Store
+
+var (
+	bucketMeta     = []byte("meta")
+	bucketCursors  = []byte("cursors")
+	bucketReports  = []byte("reports")
+	bucketChannels = []byte("channels")
+	bucketAcks     = []byte("acks")
+	bucketJobs     = []byte("jobs")
+	bucketFindings = []byte("findings")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// migrations bring the database schema up to date. The schema version is the
+// number of migrations applied, so new migrations must only be appended.
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: initial buckets
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketCursors, bucketReports, bucketChannels, bucketAcks, bucketJobs} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: open findings of jobs
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketFindings)
+		return err
+	},
+}
+
+// OpenStore opens the database at path and applies pending migrations.
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("could not open state file %s: locked by another process (is the bot running?)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open state file %s: %w", path, err)
+	}
+	s := &Store{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not migrate state file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		version := 0
+		if v := meta.Get(keySchemaVersion); v != nil {
+			version, err = strconv.Atoi(string(v))
+			if err != nil {
+				return fmt.Errorf("invalid schema version %q", v)
+			}
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("schema version %d is newer than this bot (%d)", version, len(migrations))
+		}
+		for ; version < len(migrations); version++ {
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d: %w", version+1, err)
+			}
+		}
+		return meta.Put(keySchemaVersion, []byte(strconv.Itoa(version)))
+	})
+}
+
+// guildBucket returns the bucket for a guild inside a top-level bucket,
+// creating it if writable is set. It returns nil if the bucket does not exist
+// in a read-only transaction.
+func guildBucket(tx *bolt.Tx, name []byte, guildID string, writable bool) (*bolt.Bucket, error) {
+	b := tx.Bucket(name)
+	if !writable {
+		return b.Bucket([]byte(guildID)), nil
+	}
+	return b.CreateBucketIfNotExists([]byte(guildID))
+}
+
+// appendJSON stores v under the next sequence number of b.
+func appendJSON(b *bolt.Bucket, v interface{}) error {
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return b.Put(key, data)
+}
+
+// lastJSON decodes up to n of the most recent values appended to b, newest
+// first. Values are decoded by calling decode.
+func lastJSON(b *bolt.Bucket, n int, decode func(data []byte) error) error {
+	if b == nil {
+		return nil
+	}
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil && n > 0; k, v = c.Prev() {
+		if err := decode(v); err != nil {
+			return err
+		}
+		n--
+	}
+	return nil
+}
+
+// Cursor returns the value of a named cursor, or "" if it was never set.
+func (s *Store) Cursor(guildID, name string) (string, error) {
+	var value string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, _ := guildBucket(tx, bucketCursors, guildID, false)
+		if b != nil {
+			value = string(b.Get([]byte(name)))
+		}
+		return nil
+	})
+	return value, err
+}
+
+// SetCursor updates a named cursor.
+func (s *Store) SetCursor(guildID, name, value string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketCursors, guildID, true)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), []byte(value))
+	})
+}
+
+// Report is a report posted by a job.
+type Report struct {
+	Job     string    `json:"job"`
+	Time    time.Time `json:"time"`
+	Content string    `json:"content"`
+}
+
+// AddReport saves a report.
+func (s *Store) AddReport(guildID string, r *Report) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketReports, guildID, true)
+		if err != nil {
+			return err
+		}
+		return appendJSON(b, r)
+	})
+}
+
+// LastReport returns the most recent report of a job or nil.
+func (s *Store) LastReport(guildID, job string) (*Report, error) {
+	var res *Report
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, _ := guildBucket(tx, bucketReports, guildID, false)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var r Report
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if r.Job == job {
+				res = &r
+				return nil
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// CreatedChannel is a Discord channel created by the bot.
+type CreatedChannel struct {
+	ChannelID string    `json:"channel_id"`
+	Name      string    `json:"name"`
+	Reason    string    `json:"reason"` // e.g. "host-response"
+	Created   time.Time `json:"created"`
+}
+
+// AddChannel records a created channel.
+func (s *Store) AddChannel(guildID string, c *CreatedChannel) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketChannels, guildID, true)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(c.ChannelID), data)
+	})
+}
+
+// Channels returns all channels the bot created in a guild.
+func (s *Store) Channels(guildID string) ([]*CreatedChannel, error) {
+	var res []*CreatedChannel
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, _ := guildBucket(tx, bucketChannels, guildID, false)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var c CreatedChannel
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			res = append(res, &c)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// Ack is an acknowledgement of something the bot reported, e.g. a finding
+// that should not be reported again until a certain time.
+type Ack struct {
+	Key     string    `json:"key"`
+	By      string    `json:"by"` // user ID
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"` // zero for no expiry
+}
+
+// Active reports whether the acknowledgement is in effect at t.
+func (a *Ack) Active(t time.Time) bool {
+	return a.Until.IsZero() || t.Before(a.Until)
+}
+
+// SetAck saves an acknowledgement, replacing any previous one for the key.
+func (s *Store) SetAck(guildID string, a *Ack) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketAcks, guildID, true)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(a.Key), data)
+	})
+}
+
+// Acks returns all acknowledgements of a guild by key.
+func (s *Store) Acks(guildID string) (map[string]*Ack, error) {
+	res := make(map[string]*Ack)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, _ := guildBucket(tx, bucketAcks, guildID, false)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var a Ack
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			res[a.Key] = &a
+			return nil
+		})
+	})
+	return res, err
+}
+
+// DeleteAck removes an acknowledgement.
+func (s *Store) DeleteAck(guildID, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketAcks, guildID, true)
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// JobRun is an entry in the job history.
+type JobRun struct {
+	Job   string    `json:"job"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+// AddJobRun records a job run.
+func (s *Store) AddJobRun(guildID string, r *JobRun) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketJobs, guildID, true)
+		if err != nil {
+			return err
+		}
+		return appendJSON(b, r)
+	})
+}
+
+// JobRuns returns up to n of the most recent job runs, newest first.
+func (s *Store) JobRuns(guildID string, n int) ([]*JobRun, error) {
+	var res []*JobRun
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, _ := guildBucket(tx, bucketJobs, guildID, false)
+		return lastJSON(b, n, func(data []byte) error {
+			var r JobRun
+			if err := json.Unmarshal(data, &r); err != nil {
+				return err
+			}
+			res = append(res, &r)
+			return nil
+		})
+	})
+	return res, err
+}
+
+// OpenFindings returns the findings a job last reported as open, by key.
+func (s *Store) OpenFindings(guildID, job string) (map[string]Finding, error) {
+	res := make(map[string]Finding)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b, _ := guildBucket(tx, bucketFindings, guildID, false)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(job))
+		if data == nil {
+			return nil
+		}
+		var findings []Finding
+		if err := json.Unmarshal(data, &findings); err != nil {
+			return err
+		}
+		for _, f := range findings {
+			res[f.Key()] = f
+		}
+		return nil
+	})
+	return res, err
+}
+
+// SetOpenFindings replaces the open findings of a job.
+func (s *Store) SetOpenFindings(guildID, job string, findings []Finding) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := guildBucket(tx, bucketFindings, guildID, true)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(findings)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(job), data)
+	})
+}
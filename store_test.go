@@ -0,0 +1,281 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTestStore opens a new store in a temporary directory.
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := OpenStore(filepath.Join(t.TempDir(), "uvebot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// schemaVersion returns the schema version and whether all top-level buckets
+// exist.
+func schemaVersion(t *testing.T, s *Store) (string, bool) {
+	t.Helper()
+	var version string
+	complete := true
+	err := s.db.View(func(tx *bolt.Tx) error {
+		version = string(tx.Bucket(bucketMeta).Get(keySchemaVersion))
+		for _, name := range [][]byte{bucketCursors, bucketReports, bucketChannels, bucketAcks, bucketJobs, bucketFindings} {
+			if tx.Bucket(name) == nil {
+				complete = false
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version, complete
+}
+
+func TestStoreMigrateEmpty(t *testing.T) {
+	s := openTestStore(t)
+	version, complete := schemaVersion(t, s)
+	if version != strconv.Itoa(len(migrations)) || !complete {
+		t.Errorf("schema version %s, all buckets: %v", version, complete)
+	}
+}
+
+func TestStoreMigrateFromVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uvebot.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucket(bucketMeta)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(keySchemaVersion, []byte("1")); err != nil {
+			return err
+		}
+		if err := migrations[0](tx); err != nil {
+			return err
+		}
+		b, err := guildBucket(tx, bucketCursors, "100", true)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("host-responses"), []byte("42"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	version, complete := schemaVersion(t, s)
+	if version != strconv.Itoa(len(migrations)) || !complete {
+		t.Errorf("schema version %s, all buckets: %v", version, complete)
+	}
+	if v, err := s.Cursor("100", "host-responses"); err != nil || v != "42" {
+		t.Errorf("cursor = %q, %v, want the value from version 1", v, err)
+	}
+	if err := s.SetOpenFindings("100", "check-website", []Finding{{Kind: KindMissingOnWebsite, Subject: "p"}}); err != nil {
+		t.Errorf("findings bucket not usable after migration: %v", err)
+	}
+}
+
+func TestStoreNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uvebot.db")
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keySchemaVersion, []byte(strconv.Itoa(len(migrations)+1)))
+	})
+	s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := OpenStore(path); err == nil {
+		s.Close()
+		t.Error("expected an error for a newer schema")
+	}
+}
+
+func TestStoreCursors(t *testing.T) {
+	s := openTestStore(t)
+	if v, err := s.Cursor("100", "summary"); err != nil || v != "" {
+		t.Errorf("unset cursor = %q, %v", v, err)
+	}
+	for _, value := range []string{"1", "2"} {
+		if err := s.SetCursor("100", "summary", value); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := s.Cursor("100", "summary"); err != nil || v != value {
+			t.Errorf("cursor = %q, %v, want %q", v, err, value)
+		}
+	}
+	if v, _ := s.Cursor("101", "summary"); v != "" {
+		t.Errorf("cursor of another guild = %q", v)
+	}
+}
+
+func TestStoreReports(t *testing.T) {
+	s := openTestStore(t)
+	if r, err := s.LastReport("100", "check-website"); err != nil || r != nil {
+		t.Errorf("report without any = %+v, %v", r, err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	reports := []*Report{
+		{Job: "check-website", Time: now, Content: "first"},
+		{Job: "check-website", Time: now.Add(time.Minute), Content: "second"},
+		{Job: "check-hr", Time: now.Add(2 * time.Minute), Content: "other job"},
+	}
+	for _, r := range reports {
+		if err := s.AddReport("100", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := s.LastReport("100", "check-website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, reports[1]) {
+		t.Errorf("last report = %+v, want %+v", r, reports[1])
+	}
+}
+
+func TestStoreChannels(t *testing.T) {
+	s := openTestStore(t)
+	c := &CreatedChannel{ChannelID: "300", Name: "some-piece", Reason: "host-response", Created: time.Now().UTC().Truncate(time.Second)}
+	if err := s.AddChannel("100", c); err != nil {
+		t.Fatal(err)
+	}
+	channels, err := s.Channels("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 1 || !reflect.DeepEqual(channels[0], c) {
+		t.Errorf("channels = %+v, want %+v", channels, c)
+	}
+	if channels, _ := s.Channels("101"); len(channels) != 0 {
+		t.Errorf("channels of another guild = %+v", channels)
+	}
+}
+
+func TestStoreAcks(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	forever := &Ack{Key: "missing-on-website/a", By: "1", Created: now}
+	snoozed := &Ack{Key: "missing-on-website/b", By: "2", Created: now, Until: now.Add(time.Hour)}
+	for _, a := range []*Ack{forever, snoozed} {
+		if err := s.SetAck("100", a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acks, err := s.Acks("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(acks, map[string]*Ack{forever.Key: forever, snoozed.Key: snoozed}) {
+		t.Errorf("acks = %+v", acks)
+	}
+
+	// Expiry
+	if !forever.Active(now.AddDate(10, 0, 0)) {
+		t.Error("ack without expiry is not active")
+	}
+	if !acks[snoozed.Key].Active(now.Add(59*time.Minute)) || acks[snoozed.Key].Active(now.Add(time.Hour)) {
+		t.Error("snoozed ack should be active until its expiry")
+	}
+
+	// Replacing and deleting
+	snoozed.Until = now.Add(2 * time.Hour)
+	if err := s.SetAck("100", snoozed); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAck("100", forever.Key); err != nil {
+		t.Fatal(err)
+	}
+	acks, err = s.Acks("100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acks) != 1 || !acks[snoozed.Key].Until.Equal(snoozed.Until) {
+		t.Errorf("acks = %+v, want only the extended snooze", acks)
+	}
+}
+
+func TestStoreJobRuns(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		r := &JobRun{Job: "check-website", Start: start.Add(time.Duration(i) * time.Minute), End: start.Add(time.Duration(i)*time.Minute + time.Second)}
+		if i == 3 {
+			r.Error = "website is down"
+		}
+		if err := s.AddJobRun("100", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := s.JobRuns("100", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("got %d runs, want 3", len(runs))
+	}
+	for i, r := range runs {
+		if want := start.Add(time.Duration(4-i) * time.Minute); !r.Start.Equal(want) {
+			t.Errorf("run %d started at %v, want %v (newest first)", i, r.Start, want)
+		}
+	}
+	if runs[1].Error != "website is down" {
+		t.Errorf("run error = %q", runs[1].Error)
+	}
+	if runs, err := s.JobRuns("101", 3); err != nil || len(runs) != 0 {
+		t.Errorf("runs of another guild = %+v, %v", runs, err)
+	}
+}
+
+func TestStoreOpenFindings(t *testing.T) {
+	s := openTestStore(t)
+	findings := []Finding{
+		{Check: "missing-projects", Subject: "a", Name: "a", Kind: KindMissingOnWebsite, Severity: SeverityWarning, Details: "missing on website"},
+		{Check: "pinned-urls", Subject: "b", Name: "b", Kind: KindURLNotPinned, Severity: SeverityInfo, Details: "not pinned", Links: []string{"https://example.com"}},
+	}
+	if err := s.SetOpenFindings("100", "check-website", findings); err != nil {
+		t.Fatal(err)
+	}
+	open, err := s.OpenFindings("100", "check-website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Finding{findings[0].Key(): findings[0], findings[1].Key(): findings[1]}
+	if !reflect.DeepEqual(open, want) {
+		t.Errorf("open findings = %+v, want %+v", open, want)
+	}
+
+	// Setting replaces all open findings of the job.
+	if err := s.SetOpenFindings("100", "check-website", nil); err != nil {
+		t.Fatal(err)
+	}
+	if open, _ := s.OpenFindings("100", "check-website"); len(open) != 0 {
+		t.Errorf("open findings after clearing = %+v", open)
+	}
+	if open, _ := s.OpenFindings("100", "other"); len(open) != 0 {
+		t.Errorf("open findings of another job = %+v", open)
+	}
+}